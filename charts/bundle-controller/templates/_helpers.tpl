@@ -14,12 +14,19 @@ Return the proper bundle image name
 {{ include "common.images.image" (dict "imageRoot" .Values.bundle.image "global" .Values.global) }}
 {{- end -}}
 
+{{/*
+Return the proper kubectl image name
+*/}}
+{{- define "kubegems.bundle.kubectl.image" -}}
+{{ include "common.images.image" (dict "imageRoot" .Values.bundle.webhook.kubectlImage "global" .Values.global) }}
+{{- end -}}
+
 
 {{/*
 Return the proper Docker Image Registry Secret Names
 */}}
 {{- define "kubegems.imagePullSecrets" -}}
-{{- include "common.images.pullSecrets" (dict "images" (list .Values.bundle.image ) "global" .Values.global) -}}
+{{- include "common.images.pullSecrets" (dict "images" (list .Values.bundle.image .Values.bundle.webhook.kubectlImage) "global" .Values.global) -}}
 {{- end -}}
 
 {{/*
@@ -1,12 +1,17 @@
 package apps
 
 import (
+	"io/fs"
+
 	"github.com/spf13/cobra"
 	"kubegems.io/bundle-controller/pkg/bundle"
 )
 
-func NewBundleControllerCmd() *cobra.Command {
+// NewBundleControllerCmd returns the root command,
+// searchfs are filesystems contains built-in bundles, eg. an embed.FS.
+func NewBundleControllerCmd(searchfs ...fs.FS) *cobra.Command {
 	globalOptions := bundle.NewDefaultOptions()
+	globalOptions.SearchFS = searchfs
 	cmd := &cobra.Command{
 		Use:   "bundle",
 		Short: "commands of bundle",
@@ -18,5 +23,6 @@ func NewBundleControllerCmd() *cobra.Command {
 	)
 	cmd.PersistentFlags().StringVarP(&globalOptions.CacheDir, "cache-dir", "c", globalOptions.CacheDir, "cache directory")
 	cmd.PersistentFlags().StringSliceVarP(&globalOptions.SearchDirs, "search-dir", "s", globalOptions.SearchDirs, "search bundles in directory")
+	cmd.PersistentFlags().DurationVarP(&globalOptions.Timeout, "timeout", "", globalOptions.Timeout, "default timeout of each phase of download, render and apply, or remove a bundle, 0 for no timeout")
 	return cmd
 }
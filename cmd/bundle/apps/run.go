@@ -25,5 +25,16 @@ func NewRunCmd(bundleoptions *bundle.Options) *cobra.Command {
 	cmd.Flags().StringVarP(&options.MetricsAddr, "metrics-addr", "", options.MetricsAddr, "metrics address")
 	cmd.Flags().StringVarP(&options.ProbeAddr, "probe-addr", "", options.ProbeAddr, "probe address")
 	cmd.Flags().BoolVarP(&options.EnableLeaderElection, "enable-leader-election", "", options.EnableLeaderElection, "enable leader election")
+	cmd.Flags().DurationVarP(&options.ResyncInterval, "resync-interval", "", options.ResyncInterval, "default interval to reconcile bundles again, 0 to disable")
+	cmd.Flags().StringSliceVarP(&options.WatchNamespaces, "watch-namespaces", "", options.WatchNamespaces, "namespaces to watch bundles in, default to all namespaces")
+	cmd.Flags().StringVarP(&options.BundleSelector, "bundle-selector", "", options.BundleSelector, "label selector of bundles to reconcile, default to all bundles")
+	cmd.Flags().IntVarP(&options.WebhookPort, "webhook-port", "", options.WebhookPort, "port to serve the validating webhook of bundles, 0 to disable")
+	cmd.Flags().StringVarP(&options.WebhookCertDir, "webhook-cert-dir", "", options.WebhookCertDir, "directory contains tls.crt and tls.key of the webhook server")
+	cmd.Flags().StringToStringVarP(&options.ClusterVariables, "cluster-variables", "", options.ClusterVariables, "variables of the controller cluster, substituted as ${cluster.<key>} in values of bundles opted in, also bundles installed into remote clusters, e.g. name=prod,domain=example.com")
+	cmd.Flags().StringSliceVarP(&options.ValuesFromKinds, "values-from-kinds", "", options.ValuesFromKinds, "kinds allowed in valuesFrom by jsonPath, as kind.group, e.g. Service,Bundle.bundle.kubegems.io, default to any kind")
+	cmd.Flags().BoolVarP(&bundleoptions.RequireServiceAccount, "require-service-account", "", bundleoptions.RequireServiceAccount, "require bundles to set serviceAccountName, all bundles are applied impersonating their service account")
+	cmd.Flags().BoolVarP(&options.Freeze, "freeze", "", options.Freeze, "freeze all bundles, installed resources are kept")
+	cmd.Flags().BoolVarP(&options.FreezeAllowDeletion, "freeze-allow-deletion", "", options.FreezeAllowDeletion, "allow deleting bundles be removed while frozen")
+	cmd.Flags().StringVarP(&options.FreezeConfigMap, "freeze-configmap", "", options.FreezeConfigMap, "namespace/name of configmap to freeze bundles at runtime, by keys \"freeze\" and \"allowDeletion\"")
 	return cmd
 }
\ No newline at end of file
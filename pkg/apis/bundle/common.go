@@ -5,3 +5,34 @@ const (
 	AnnotationIgnoreOptionOnUpdate = "OnUpdate"
 	AnnotationIgnoreOptionOnDelete = "OnDelete"
 )
+
+const (
+	// AnnotationForceRemove set to "true" to remove a bundle even if other installed bundles depend on it.
+	AnnotationForceRemove = "bundle.kubegems.io/force-remove"
+	// AnnotationRemoveDependents set to "true" to remove bundles depend on it first when removing a bundle.
+	// Dependents are deleted or disabled the same as the bundle, and the annotation is propagated to them.
+	AnnotationRemoveDependents = "bundle.kubegems.io/remove-dependents"
+)
+
+const (
+	// AnnotationRemoveReleaseRecord set to "true" to remove the helm release record when orphaning a helm bundle,
+	// the release resources are kept running.
+	AnnotationRemoveReleaseRecord = "bundle.kubegems.io/remove-release-record"
+	// AnnotationSkipCleanup set to "true" to delete a bundle without removing its installed resources,
+	// used when removing keeps failing.
+	AnnotationSkipCleanup = "bundle.kubegems.io/skip-cleanup"
+)
+
+const (
+	// AnnotationAllowedNamespaces on a configmap or secret is a comma separated list of namespaces
+	// whose bundles are granted to reference it in .spec.valuesFrom, "*" grants all namespaces.
+	AnnotationAllowedNamespaces = "bundle.kubegems.io/allowed-namespaces"
+)
+
+const (
+	// AnnotationSubstitute set to "enabled" to substitute variables in .spec.values of a bundle,
+	// which is enabled by .spec.variablesFrom as well, or "disabled" to skip it.
+	AnnotationSubstitute         = "bundle.kubegems.io/substitute"
+	AnnotationSubstituteEnabled  = "enabled"
+	AnnotationSubstituteDisabled = "disabled"
+)
@@ -0,0 +1,173 @@
+package v1
+
+import (
+	"kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+)
+
+// ConvertTo converts the bundle to the hub version v1beta1.
+func (src *Bundle) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*v1beta1.Bundle)
+	dst.ObjectMeta = src.ObjectMeta
+	spec := src.Spec
+	dst.Spec = v1beta1.BundleSpec{
+		Kind:               v1beta1.BundleKind(spec.Source.Kind),
+		URL:                spec.Source.URL,
+		Chart:              spec.Source.Chart,
+		Version:            spec.Source.Version,
+		Path:               spec.Source.Path,
+		ContentFrom:        convertSlice(spec.Source.ContentFrom, func(in ContentFrom) v1beta1.ContentFrom { return v1beta1.ContentFrom(in) }),
+		Disabled:           spec.Install.Disabled,
+		InstallNamespace:   spec.Install.Namespace,
+		ServiceAccountName: spec.Install.ServiceAccountName,
+		Values:             v1beta1.Values(spec.Values),
+		ValuesFrom:         convertSlice(spec.ValuesFrom, func(in ValuesFrom) v1beta1.ValuesFrom { return v1beta1.ValuesFrom(in) }),
+		VariablesFrom:      convertSlice(spec.VariablesFrom, func(in VariablesFrom) v1beta1.VariablesFrom { return v1beta1.VariablesFrom(in) }),
+		Dependencies:       spec.Dependencies,
+		HealthChecks:       convertSlice(spec.HealthChecks, func(in HealthCheck) v1beta1.HealthCheck { return v1beta1.HealthCheck(in) }),
+		Suspend:            spec.Policy.Suspend,
+		Interval:           spec.Policy.Interval,
+		Timeout:            spec.Policy.Timeout,
+		DeletionPolicy:     v1beta1.DeletionPolicy(spec.Policy.DeletionPolicy),
+	}
+	if kubeconfig := spec.Install.KubeConfig; kubeconfig != nil {
+		dst.Spec.KubeConfig = &v1beta1.KubeConfig{SecretRef: v1beta1.SecretKeyReference(kubeconfig.SecretRef)}
+	}
+	if remediation := spec.Policy.Remediation; remediation != nil {
+		dst.Spec.Remediation = &v1beta1.Remediation{
+			Strategy: v1beta1.RemediationStrategy(remediation.Strategy),
+			Retries:  remediation.Retries,
+		}
+	}
+	if outputs := spec.Outputs; outputs != nil {
+		dst.Spec.Outputs = &v1beta1.Outputs{
+			Kind:   outputs.Kind,
+			Name:   outputs.Name,
+			Values: convertSlice(outputs.Values, func(in Output) v1beta1.Output { return v1beta1.Output(in) }),
+		}
+	}
+
+	status := src.Status
+	dst.Status = v1beta1.BundleStatus{
+		Phase:              v1beta1.Phase(status.Phase),
+		ObservedGeneration: status.ObservedGeneration,
+		Conditions:         status.Conditions,
+		Health:             v1beta1.HealthStatus(status.Health),
+		Message:            status.Message,
+		Values:             v1beta1.Values(status.Values),
+		Version:            status.Version,
+		AppVersion:         status.AppVersion,
+		Namespace:          status.Namespace,
+		CreationTimestamp:  status.CreationTimestamp,
+		UpgradeTimestamp:   status.UpgradeTimestamp,
+		ResyncTimestamp:    status.ResyncTimestamp,
+		Resources:          status.Resources,
+		Upstreams:          status.Upstreams,
+	}
+	if outputs := status.Outputs; outputs != nil {
+		dst.Status.Outputs = &v1beta1.OutputsReference{Kind: outputs.Kind, Name: outputs.Name}
+	}
+	if remediation := status.Remediation; remediation != nil {
+		dst.Status.Remediation = &v1beta1.RemediationStatus{
+			ObservedGeneration: remediation.ObservedGeneration,
+			ValuesHash:         remediation.ValuesHash,
+			Failures:           remediation.Failures,
+			LastStrategy:       v1beta1.RemediationStrategy(remediation.LastStrategy),
+			LastTimestamp:      remediation.LastTimestamp,
+			LastMessage:        remediation.LastMessage,
+		}
+	}
+	return nil
+}
+
+// ConvertFrom converts the hub version v1beta1 to this version.
+func (dst *Bundle) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*v1beta1.Bundle)
+	dst.ObjectMeta = src.ObjectMeta
+	spec := src.Spec
+	dst.Spec = BundleSpec{
+		Source: Source{
+			Kind:        BundleKind(spec.Kind),
+			URL:         spec.URL,
+			Chart:       spec.Chart,
+			Version:     spec.Version,
+			Path:        spec.Path,
+			ContentFrom: convertSlice(spec.ContentFrom, func(in v1beta1.ContentFrom) ContentFrom { return ContentFrom(in) }),
+		},
+		Install: Install{
+			Disabled:           spec.Disabled,
+			Namespace:          spec.InstallNamespace,
+			ServiceAccountName: spec.ServiceAccountName,
+		},
+		Values:        Values(spec.Values),
+		ValuesFrom:    convertSlice(spec.ValuesFrom, func(in v1beta1.ValuesFrom) ValuesFrom { return ValuesFrom(in) }),
+		VariablesFrom: convertSlice(spec.VariablesFrom, func(in v1beta1.VariablesFrom) VariablesFrom { return VariablesFrom(in) }),
+		Dependencies:  spec.Dependencies,
+		HealthChecks:  convertSlice(spec.HealthChecks, func(in v1beta1.HealthCheck) HealthCheck { return HealthCheck(in) }),
+		Policy: Policy{
+			Suspend:        spec.Suspend,
+			Interval:       spec.Interval,
+			Timeout:        spec.Timeout,
+			DeletionPolicy: DeletionPolicy(spec.DeletionPolicy),
+		},
+	}
+	if kubeconfig := spec.KubeConfig; kubeconfig != nil {
+		dst.Spec.Install.KubeConfig = &KubeConfig{SecretRef: SecretKeyReference(kubeconfig.SecretRef)}
+	}
+	if remediation := spec.Remediation; remediation != nil {
+		dst.Spec.Policy.Remediation = &Remediation{
+			Strategy: RemediationStrategy(remediation.Strategy),
+			Retries:  remediation.Retries,
+		}
+	}
+	if outputs := spec.Outputs; outputs != nil {
+		dst.Spec.Outputs = &Outputs{
+			Kind:   outputs.Kind,
+			Name:   outputs.Name,
+			Values: convertSlice(outputs.Values, func(in v1beta1.Output) Output { return Output(in) }),
+		}
+	}
+
+	status := src.Status
+	dst.Status = BundleStatus{
+		Phase:              Phase(status.Phase),
+		ObservedGeneration: status.ObservedGeneration,
+		Conditions:         status.Conditions,
+		Health:             HealthStatus(status.Health),
+		Message:            status.Message,
+		Values:             Values(status.Values),
+		Version:            status.Version,
+		AppVersion:         status.AppVersion,
+		Namespace:          status.Namespace,
+		CreationTimestamp:  status.CreationTimestamp,
+		UpgradeTimestamp:   status.UpgradeTimestamp,
+		ResyncTimestamp:    status.ResyncTimestamp,
+		Resources:          status.Resources,
+		Upstreams:          status.Upstreams,
+	}
+	if outputs := status.Outputs; outputs != nil {
+		dst.Status.Outputs = &OutputsReference{Kind: outputs.Kind, Name: outputs.Name}
+	}
+	if remediation := status.Remediation; remediation != nil {
+		dst.Status.Remediation = &RemediationStatus{
+			ObservedGeneration: remediation.ObservedGeneration,
+			ValuesHash:         remediation.ValuesHash,
+			Failures:           remediation.Failures,
+			LastStrategy:       RemediationStrategy(remediation.LastStrategy),
+			LastTimestamp:      remediation.LastTimestamp,
+			LastMessage:        remediation.LastMessage,
+		}
+	}
+	return nil
+}
+
+func convertSlice[T, U any](in []T, convert func(T) U) []U {
+	if in == nil {
+		return nil
+	}
+	out := make([]U, len(in))
+	for i := range in {
+		out[i] = convert(in[i])
+	}
+	return out
+}
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+)
+
+func TestConversionRoundTrip(t *testing.T) {
+	hub := &v1beta1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Spec: v1beta1.BundleSpec{
+			Disabled:           true,
+			Suspend:            true,
+			DeletionPolicy:     v1beta1.DeletionPolicyOrphan,
+			Kind:               v1beta1.BundleKindHelm,
+			URL:                "https://charts.example.com",
+			Version:            "1.0.0",
+			Chart:              "bar",
+			Path:               "charts/bar",
+			ContentFrom:        []v1beta1.ContentFrom{{Kind: "ConfigMap", Name: "content", Path: "templates"}},
+			InstallNamespace:   "bar",
+			KubeConfig:         &v1beta1.KubeConfig{SecretRef: v1beta1.SecretKeyReference{Name: "remote", Key: "config"}},
+			ServiceAccountName: "deployer",
+			Interval:           &metav1.Duration{Duration: time.Minute},
+			Timeout:            &metav1.Duration{Duration: time.Hour},
+			Remediation:        &v1beta1.Remediation{Strategy: v1beta1.RemediationStrategyRollback, Retries: 3},
+			Dependencies:       []corev1.ObjectReference{{Name: "base"}},
+			Values:             v1beta1.Values{Object: map[string]interface{}{"replicas": "2"}},
+			ValuesFrom:         []v1beta1.ValuesFrom{{Kind: "Secret", Name: "values", Prefix: "foo.", Optional: true}},
+			HealthChecks:       []v1beta1.HealthCheck{{APIVersion: "v1", Kind: "Pod", Name: "bar", JSONPath: "{.status.phase}", Value: "Running"}},
+			Outputs:            &v1beta1.Outputs{Kind: "Secret", Values: []v1beta1.Output{{Key: "host", APIVersion: "v1", Kind: "Service", Name: "bar", JSONPath: "{.spec.clusterIP}"}}},
+		},
+		Status: v1beta1.BundleStatus{
+			Phase:       v1beta1.PhaseInstalled,
+			Health:      v1beta1.HealthStatusHealthy,
+			Namespace:   "bar",
+			Resources:   []corev1.ObjectReference{{Kind: "Pod", Name: "bar"}},
+			Remediation: &v1beta1.RemediationStatus{ObservedGeneration: 2, Failures: 1, LastStrategy: v1beta1.RemediationStrategyRollback},
+		},
+	}
+
+	bundle := &Bundle{}
+	if err := bundle.ConvertFrom(hub); err != nil {
+		t.Fatalf("ConvertFrom() error = %v", err)
+	}
+	if bundle.Spec.Source.Kind != BundleKindHelm || bundle.Spec.Install.Namespace != "bar" || bundle.Spec.Policy.Remediation.Retries != 3 {
+		t.Errorf("ConvertFrom() spec = %+v", bundle.Spec)
+	}
+	converted := &v1beta1.Bundle{}
+	if err := bundle.ConvertTo(converted); err != nil {
+		t.Fatalf("ConvertTo() error = %v", err)
+	}
+	if !reflect.DeepEqual(hub, converted) {
+		t.Errorf("round trip = %+v, want %+v", converted, hub)
+	}
+}
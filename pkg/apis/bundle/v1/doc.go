@@ -0,0 +1,5 @@
+// +k8s:deepcopy-gen=package
+// +groupName=bundle.kubegems.io
+
+// Package v1 is the v1 version of the API.
+package v1 // import "kubegems.io/bundle-controller/pkg/apis/bundle/v1"
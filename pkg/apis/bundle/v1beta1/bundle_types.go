@@ -3,6 +3,7 @@ package v1beta1
 import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
 )
 
 // +kubebuilder:object:root=true
@@ -10,6 +11,8 @@ import (
 // +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="Kind",type="string",JSONPath=".spec.kind",description="Kind of the bundle"
 // +kubebuilder:printcolumn:name="Status",type="string",JSONPath=".status.phase",description="Status of the bundle"
+// +kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Ready condition of the bundle"
+// +kubebuilder:printcolumn:name="Health",type="string",JSONPath=".status.health",description="Health of the bundle"
 // +kubebuilder:printcolumn:name="Namespace",type="string",JSONPath=".status.namespace",description="Install Namespace of the bundle"
 // +kubebuilder:printcolumn:name="Version",type="string",JSONPath=".status.version",description="Version of the bundle"
 // +kubebuilder:printcolumn:name="AppVersion",type="string",JSONPath=".status.appVersion",description="app version of the bundle"
@@ -23,10 +26,33 @@ type Bundle struct {
 	Status BundleStatus `json:"status,omitempty"`
 }
 
+// SubstitutionEnabled returns true if the bundle opts in substituting variables in .spec.values,
+// by annotation bundle.kubegems.io/substitute or by .spec.variablesFrom.
+func (b *Bundle) SubstitutionEnabled() bool {
+	switch b.Annotations[bundlecommon.AnnotationSubstitute] {
+	case bundlecommon.AnnotationSubstituteEnabled:
+		return true
+	case bundlecommon.AnnotationSubstituteDisabled:
+		return false
+	default:
+		return len(b.Spec.VariablesFrom) > 0
+	}
+}
+
 type BundleSpec struct {
 	// Disabled indicates that the bundle should not be installed.
 	Disabled bool `json:"disabled,omitempty"`
 
+	// Suspend tells the controller to stop syncing the bundle, installed resources are kept.
+	// A suspended bundle can still be deleted.
+	// +kubebuilder:validation:Optional
+	Suspend bool `json:"suspend,omitempty"`
+
+	// DeletionPolicy is what to do with installed resources when the bundle is deleted, default to Delete.
+	// Orphan keeps the resources running and only removes the bookkeeping of the bundle.
+	// +kubebuilder:validation:Optional
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+
 	// Kind bundle kind.
 	Kind BundleKind `json:"kind,omitempty"`
 
@@ -42,10 +68,39 @@ type BundleSpec struct {
 	// Path is the path in a tarball to the chart/kustomize.
 	Path string `json:"path,omitempty"`
 
+	// ContentFrom is a list of references to configmaps or secrets contains the bundle files.
+	// If set, the bundle is read from them instead of URL.
+	// +kubebuilder:validation:Optional
+	ContentFrom []ContentFrom `json:"contentFrom,omitempty"`
+
 	// InstallNamespace is the namespace to install the bundle into.
 	// If not specified, the bundle will be installed into the namespace of the bundle.
 	InstallNamespace string `json:"installNamespace,omitempty"`
 
+	// KubeConfig is the kubeconfig of a remote cluster to install the bundle into.
+	// If not specified, the bundle will be installed into the cluster the controller runs in.
+	// +kubebuilder:validation:Optional
+	KubeConfig *KubeConfig `json:"kubeConfig,omitempty"`
+
+	// ServiceAccountName is the service account in the bundle namespace to impersonate when applying the bundle.
+	// If not specified, the bundle is applied by the controller's identity.
+	// +kubebuilder:validation:Optional
+	ServiceAccountName string `json:"serviceAccountName,omitempty"`
+
+	// Interval is the period to reconcile the bundle again, resources of an up to date bundle are applied again on each interval.
+	// Default to the controller's resync interval, set to "0s" to disable periodic reconciliation.
+	// +kubebuilder:validation:Optional
+	Interval *metav1.Duration `json:"interval,omitempty"`
+
+	// Timeout is the max duration of each phase of download, render and apply, or remove.
+	// Default to the controller's timeout.
+	// +kubebuilder:validation:Optional
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Remediation is the action to take when applying the bundle failed.
+	// +kubebuilder:validation:Optional
+	Remediation *Remediation `json:"remediation,omitempty"`
+
 	// Dependencies is a list of bundles that this bundle depends on.
 	// The bundle will be installed after all dependencies are exists.
 	Dependencies []corev1.ObjectReference `json:"dependencies,omitempty"` // dependends on other bundle
@@ -56,28 +111,209 @@ type BundleSpec struct {
 	Values Values `json:"values,omitempty"`
 
 	// ValuesFiles is a list of references to helm values files.
-	// Ref can be a configmap or secret.
+	// Ref can be a configmap, secret or a field of other object by jsonPath.
 	// +kubebuilder:validation:Optional
 	ValuesFrom []ValuesFrom `json:"valuesFrom,omitempty"`
+
+	// VariablesFrom is a list of configmaps or secrets in the bundle namespace, their keys are variables
+	// substituted as "${key}" in values, in addition to "${bundle.name}", "${bundle.namespace}",
+	// "${bundle.installNamespace}" and "${cluster.<key>}" of the controller's cluster variables.
+	// Setting it enables substitution, which is off by default.
+	// +kubebuilder:validation:Optional
+	VariablesFrom []VariablesFrom `json:"variablesFrom,omitempty"`
+
+	// HealthChecks is a list of custom checks must pass before the bundle is healthy,
+	// in addition to the built-in checks on applied resources.
+	// +kubebuilder:validation:Optional
+	HealthChecks []HealthCheck `json:"healthChecks,omitempty"`
+
+	// Outputs are exported to a ConfigMap or Secret in the bundle namespace once the bundle is installed,
+	// so dependents can use them by valuesFrom.
+	// +kubebuilder:validation:Optional
+	Outputs *Outputs `json:"outputs,omitempty"`
 }
 
 type ValuesFrom struct {
-	// Kind is the type of resource being referenced
-	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	// APIVersion is the api version of resource being referenced, default to "v1".
+	// +kubebuilder:validation:Optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind is the type of resource being referenced,
+	// any kind other than ConfigMap and Secret requires jsonPath.
 	Kind string `json:"kind"`
 	// Name is the name of resource being referenced
 	Name string `json:"name"`
+	// Namespace is the namespace of resource being referenced, default to the bundle namespace.
+	// A resource in other namespace must grant the bundle namespace by annotation "bundle.kubegems.io/allowed-namespaces".
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
 	// An optional identifier to prepend to each key in the ConfigMap. Must be a C_IDENTIFIER.
 	// +kubebuilder:validation:Optional
 	Prefix string `json:"prefix,omitempty"`
+	// ValuesKey is the only key of the resource to use, default to all keys.
+	// +kubebuilder:validation:Optional
+	ValuesKey string `json:"valuesKey,omitempty"`
+	// TargetPath is the path in values to place the value at, in the syntax of helm --set, e.g. "auth.password".
+	// It requires a single key by valuesKey, unless the value is taken by jsonPath.
+	// +kubebuilder:validation:Optional
+	TargetPath string `json:"targetPath,omitempty"`
+	// Format is how the value of a key is merged into values:
+	// "yaml" merges it as a values file like helm -f, "set" parses it as --set expressions,
+	// "raw-string" uses it as a string like --set-file.
+	// Default to "yaml" for binaryData of a ConfigMap and "set" for others.
+	// +kubebuilder:validation:Enum=yaml;set;raw-string
+	// +kubebuilder:validation:Optional
+	Format string `json:"format,omitempty"`
+	// JSONPath is a jsonpath expression evaluated on the resource, e.g. "{.spec.clusterIP}".
+	// The result is placed at targetPath, a map result is merged into values root if targetPath is empty.
+	// Data of a Secret is base64 encoded here, use valuesKey instead to get decoded data.
+	// +kubebuilder:validation:Optional
+	JSONPath string `json:"jsonPath,omitempty"`
+	// Optional set to true to ignore referense not found error
+	Optional bool `json:"optional,omitempty"`
+}
+
+type VariablesFrom struct {
+	// Kind is the type of resource being referenced
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// Name is the name of resource being referenced
+	Name string `json:"name"`
 	// Optional set to true to ignore referense not found error
+	// +kubebuilder:validation:Optional
 	Optional bool `json:"optional,omitempty"`
 }
 
+type ContentFrom struct {
+	// Kind is the type of resource being referenced
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	Kind string `json:"kind"`
+	// Name is the name of resource being referenced
+	Name string `json:"name"`
+	// Path is the directory in the bundle to place the files in, default to bundle root.
+	// Each key of the resource is a file name, keys end with ".tgz" or ".tar.gz" are extracted.
+	// +kubebuilder:validation:Optional
+	Path string `json:"path,omitempty"`
+}
+
+type KubeConfig struct {
+	// SecretRef is a secret in the bundle namespace contains the kubeconfig.
+	SecretRef SecretKeyReference `json:"secretRef"`
+}
+
+type SecretKeyReference struct {
+	// Name of the secret.
+	Name string `json:"name"`
+	// Key in the secret, default to "kubeconfig".
+	// +kubebuilder:validation:Optional
+	Key string `json:"key,omitempty"`
+}
+
+type Outputs struct {
+	// Kind is the kind of object to export outputs to, ConfigMap or Secret, default to ConfigMap.
+	// +kubebuilder:validation:Enum=ConfigMap;Secret
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+	// Name is the name of object to export outputs to, default to "<bundle name>-outputs".
+	// The object is owned by the bundle, an existing object not owned by it is not overwritten.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+	// Values is a list of keys to export.
+	Values []Output `json:"values"`
+}
+
+type Output struct {
+	// Key is the key in the ConfigMap or Secret.
+	Key string `json:"key"`
+	// APIVersion of the resource to evaluate jsonPath on.
+	// +kubebuilder:validation:Optional
+	APIVersion string `json:"apiVersion,omitempty"`
+	// Kind of the resource to evaluate jsonPath on, it must be one of applied resources of the bundle.
+	// If empty, jsonPath is evaluated on the final values of the bundle.
+	// +kubebuilder:validation:Optional
+	Kind string `json:"kind,omitempty"`
+	// Name of the resource to evaluate jsonPath on.
+	// +kubebuilder:validation:Optional
+	Name string `json:"name,omitempty"`
+	// Namespace of the resource, default to the install namespace for namespaced resources.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+	// JSONPath is a jsonpath expression, e.g. "{.spec.clusterIP}" on a Service or "{.auth.password}" on values.
+	// A string result is exported as is, others are exported as json.
+	JSONPath string `json:"jsonPath"`
+}
+
+type HealthCheck struct {
+	// APIVersion of the resource to check.
+	APIVersion string `json:"apiVersion"`
+	// Kind of the resource to check.
+	Kind string `json:"kind"`
+	// Name of the resource to check.
+	Name string `json:"name"`
+	// Namespace of the resource to check, default to the install namespace for namespaced resources.
+	// +kubebuilder:validation:Optional
+	Namespace string `json:"namespace,omitempty"`
+	// JSONPath is a jsonpath expression evaluated on the resource, e.g. "{.status.phase}".
+	JSONPath string `json:"jsonPath"`
+	// Value is the expected result of JSONPath.
+	// If empty, the check passes when the result is neither empty nor "false".
+	// +kubebuilder:validation:Optional
+	Value string `json:"value,omitempty"`
+}
+
+type Remediation struct {
+	// Strategy is the remediation to take on a failed apply, default to none.
+	// rollback: roll back to the last successfully applied revision.
+	// uninstall: remove the bundle.
+	// +kubebuilder:validation:Optional
+	Strategy RemediationStrategy `json:"strategy,omitempty"`
+	// Retries is the number of times to retry a failed apply of a generation.
+	// Once exhausted, the bundle is kept failed until the spec or resolved values changed.
+	// +kubebuilder:validation:Optional
+	// +kubebuilder:validation:Minimum=0
+	Retries int `json:"retries,omitempty"`
+}
+
+// +kubebuilder:validation:Enum=rollback;uninstall;none
+type RemediationStrategy string
+
+const (
+	RemediationStrategyRollback  RemediationStrategy = "rollback"
+	RemediationStrategyUninstall RemediationStrategy = "uninstall"
+	RemediationStrategyNone      RemediationStrategy = "none"
+)
+
+type RemediationStatus struct {
+	// ObservedGeneration is the generation the failures counted on.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ValuesHash is the hash of resolved values the failures counted on.
+	ValuesHash string `json:"valuesHash,omitempty"`
+	// Failures is the number of failed apply of the generation and values.
+	Failures int `json:"failures,omitempty"`
+	// LastStrategy is the last remediation taken.
+	LastStrategy RemediationStrategy `json:"lastStrategy,omitempty"`
+	// LastTimestamp is the time of last remediation.
+	LastTimestamp metav1.Time `json:"lastTimestamp,omitempty"`
+	// LastMessage is the result of last remediation.
+	LastMessage string `json:"lastMessage,omitempty"`
+}
+
 type BundleStatus struct {
 	// Phase is the current state of the release
 	Phase Phase `json:"phase,omitempty"`
 
+	// ObservedGeneration is the last generation of the bundle reconciled.
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+
+	// Conditions are the latest observations of the bundle's state.
+	// +listType=map
+	// +listMapKey=type
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Health is the aggregated health of applied resources and custom health checks.
+	Health HealthStatus `json:"health,omitempty"`
+
 	// Message is the message associated with the status
 	// In helm, it's the notes contens.
 	Message string `json:"message,omitempty"`
@@ -102,8 +338,28 @@ type BundleStatus struct {
 	// UpgradeTimestamp is the time when the bundle was last upgraded.
 	UpgradeTimestamp metav1.Time `json:"upgradeTimestamp,omitempty"`
 
+	// ResyncTimestamp is the time when resources of the up to date bundle were last applied again on resync.
+	ResyncTimestamp metav1.Time `json:"resyncTimestamp,omitempty"`
+
 	// Resources is a list of resources created/managed by the bundle.
 	Resources []corev1.ObjectReference `json:"resources,omitempty"`
+
+	// Remediation is the failures and the last remediation of the bundle.
+	Remediation *RemediationStatus `json:"remediation,omitempty"`
+
+	// Upstreams is the resolved upstream bundles the bundle depends on directly or transitively, in install order.
+	Upstreams []corev1.ObjectReference `json:"upstreams,omitempty"`
+
+	// Outputs is the object in the bundle namespace the outputs were last exported to.
+	Outputs *OutputsReference `json:"outputs,omitempty"`
+}
+
+type OutputsReference struct {
+	// Kind is ConfigMap or Secret.
+	Kind string `json:"kind"`
+
+	// Name is the name of the object.
+	Name string `json:"name"`
 }
 
 type ManagedResource struct {
@@ -113,7 +369,7 @@ type ManagedResource struct {
 	Name       string `json:"name,omitempty"`
 }
 
-//+kubebuilder:object:root=true
+// +kubebuilder:object:root=true
 type BundleList struct {
 	metav1.TypeMeta `json:",inline"`
 	metav1.ListMeta `json:"metadata,omitempty"`
@@ -123,6 +379,29 @@ type BundleList struct {
 
 type Phase string
 
+// +kubebuilder:validation:Enum=Delete;Orphan
+type DeletionPolicy string
+
+const (
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+	DeletionPolicyOrphan DeletionPolicy = "Orphan"
+)
+
+// formats of ValuesFrom.
+const (
+	ValuesFormatYAML      = "yaml"
+	ValuesFormatSet       = "set"
+	ValuesFormatRawString = "raw-string"
+)
+
+type HealthStatus string
+
+const (
+	HealthStatusHealthy     HealthStatus = "Healthy"     // All resources are ready.
+	HealthStatusProgressing HealthStatus = "Progressing" // Some resources are not ready yet, e.g. a Deployment is rolling out.
+	HealthStatusDegraded    HealthStatus = "Degraded"    // Some resources failed, e.g. a Job failed or a rollout exceeded its deadline.
+)
+
 // +kubebuilder:validation:Enum=helm;kustomize;template
 type BundleKind string
 
@@ -133,7 +412,13 @@ const (
 )
 
 const (
-	PhaseDisabled  Phase = "Disabled"  // Bundle is disabled. the .spce.disbaled field is set to true or DeletionTimestamp is set.
-	PhaseFailed    Phase = "Failed"    // Failed on install.
-	PhaseInstalled Phase = "Installed" // Bundle is installed
+	PhasePending                Phase = "Pending"                // Bundle is accepted and waiting to be processed.
+	PhaseWaitingForDependencies Phase = "WaitingForDependencies" // Bundle is waiting for its dependencies to be installed.
+	PhaseInstalling             Phase = "Installing"             // Bundle is being installed for the first time.
+	PhaseUpgrading              Phase = "Upgrading"              // Bundle is being upgraded to a new generation.
+	PhaseUninstalling           Phase = "Uninstalling"           // Bundle is being removed.
+	PhaseDisabled               Phase = "Disabled"               // Bundle is disabled. the .spce.disbaled field is set to true or DeletionTimestamp is set.
+	PhaseFailed                 Phase = "Failed"                 // Failed on install.
+	PhaseSuspended              Phase = "Suspended"              // Bundle is not synced, by .spec.suspend or the controller is frozen.
+	PhaseInstalled              Phase = "Installed"              // Bundle is installed
 )
@@ -0,0 +1,147 @@
+package v1beta1
+
+import (
+	"context"
+	"errors"
+
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	ConditionReady             = "Ready"             // Bundle is installed and all other conditions are satisfied.
+	ConditionSourceReady       = "SourceReady"       // Bundle source is downloaded and values are resolved.
+	ConditionDependenciesReady = "DependenciesReady" // All dependencies are installed.
+	ConditionRendered          = "Rendered"          // Bundle manifests are rendered.
+	ConditionApplied           = "Applied"           // Bundle manifests are applied to cluster.
+	ConditionHealthy           = "Healthy"           // Applied resources are healthy.
+	ConditionOutputsReady      = "OutputsReady"      // Outputs are exported, only set if the bundle has outputs.
+	ConditionRemovable         = "Removable"         // Bundle is being removed and no installed bundles depend on it.
+	ConditionSuspended         = "Suspended"         // Bundle is not synced, it is not a ready condition.
+)
+
+const (
+	ReasonSucceeded           = "Succeeded"
+	ReasonDisabled            = "Disabled"
+	ReasonDownloadFailed      = "DownloadFailed"
+	ReasonValuesResolveFailed = "ValuesResolveFailed"
+	ReasonDependencyNotReady  = "DependencyNotReady"
+	ReasonDependencyMissing   = "DependencyMissing"
+	ReasonDependencyCycle     = "DependencyCycle"
+	ReasonRenderFailed        = "RenderFailed"
+	ReasonApplyFailed         = "ApplyFailed"
+	ReasonRemoveFailed        = "RemoveFailed"
+	ReasonNotDeployed         = "NotDeployed"
+	ReasonProgressing         = "Progressing"
+	ReasonDegraded            = "Degraded"
+	ReasonHealthCheckFailed   = "HealthCheckFailed"
+	ReasonOutputsFailed       = "OutputsFailed"
+	ReasonOutputsPending      = "OutputsPending"
+	ReasonTimeout             = "Timeout"
+	ReasonSuspended           = "Suspended"
+	ReasonFrozen              = "Frozen"
+	ReasonDependentsInstalled = "DependentsInstalled"
+	ReasonNotReached          = "NotReached"
+)
+
+// readyConditions are conditions that must be true for a bundle to be ready, in checking order.
+var readyConditions = []string{
+	ConditionDependenciesReady,
+	ConditionSourceReady,
+	ConditionRendered,
+	ConditionApplied,
+	ConditionHealthy,
+	ConditionOutputsReady,
+	ConditionRemovable,
+}
+
+// stageConditions are conditions of sync stages run in order, a stage is not reached once an earlier one failed.
+var stageConditions = []string{
+	ConditionRendered,
+	ConditionApplied,
+	ConditionHealthy,
+	ConditionOutputsReady,
+}
+
+// SetCondition sets the condition of type t with bundle's current generation.
+func (b *Bundle) SetCondition(t string, status metav1.ConditionStatus, reason, message string) {
+	apimeta.SetStatusCondition(&b.Status.Conditions, metav1.Condition{
+		Type:               t,
+		Status:             status,
+		ObservedGeneration: b.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// GetCondition returns the condition of type t, nil if not exists.
+func (b *Bundle) GetCondition(t string) *metav1.Condition {
+	return apimeta.FindStatusCondition(b.Status.Conditions, t)
+}
+
+// RemoveCondition removes the condition of type t.
+func (b *Bundle) RemoveCondition(t string) {
+	apimeta.RemoveStatusCondition(&b.Status.Conditions, t)
+}
+
+// IsConditionTrue returns true if the condition of type t is true.
+func (b *Bundle) IsConditionTrue(t string) bool {
+	return apimeta.IsStatusConditionTrue(b.Status.Conditions, t)
+}
+
+// SetReadyCondition summarizes other conditions into Ready condition.
+// err is the error of the last sync, its message is used when not ready.
+func (b *Bundle) SetReadyCondition(err error) {
+	if b.Status.Phase == PhaseDisabled {
+		b.SetCondition(ConditionReady, metav1.ConditionFalse, ReasonDisabled, "bundle is disabled")
+		return
+	}
+	for _, t := range readyConditions {
+		cond := b.GetCondition(t)
+		// a stage not reached in the last sync is not the cause
+		if cond == nil || cond.Status == metav1.ConditionTrue || cond.Reason == ReasonNotReached {
+			continue
+		}
+		message := cond.Message
+		if err != nil {
+			message = err.Error()
+		}
+		b.SetCondition(ConditionReady, metav1.ConditionFalse, cond.Reason, message)
+		b.setStagesNotReached(t)
+		return
+	}
+	if err != nil {
+		reason := ReasonApplyFailed
+		if errors.Is(err, context.DeadlineExceeded) {
+			reason = ReasonTimeout
+		}
+		b.SetCondition(ConditionReady, metav1.ConditionFalse, reason, err.Error())
+		return
+	}
+	b.SetCondition(ConditionReady, metav1.ConditionTrue, ReasonSucceeded, "")
+}
+
+// setStagesNotReached sets existing conditions of stages after the failed condition unknown,
+// they are left by a previous sync and not observed in this one.
+func (b *Bundle) setStagesNotReached(failed string) {
+	reached := true
+	for _, t := range readyConditions {
+		if t == failed {
+			reached = false
+			continue
+		}
+		if reached || !contains(stageConditions, t) || b.GetCondition(t) == nil {
+			continue
+		}
+		b.SetCondition(t, metav1.ConditionUnknown, ReasonNotReached, failed+" is not true")
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
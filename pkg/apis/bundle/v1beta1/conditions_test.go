@@ -0,0 +1,113 @@
+package v1beta1
+
+import (
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestBundle_SetReadyCondition(t *testing.T) {
+	type condition struct {
+		status metav1.ConditionStatus
+		reason string
+	}
+	tests := []struct {
+		name       string
+		phase      Phase
+		conditions map[string]condition
+		err        error
+		wantStatus metav1.ConditionStatus
+		wantReason string
+		// wantStages are the statuses of stage conditions after set
+		wantStages map[string]metav1.ConditionStatus
+	}{
+		{
+			name:  "all true",
+			phase: PhaseInstalled,
+			conditions: map[string]condition{
+				ConditionSourceReady: {metav1.ConditionTrue, ReasonSucceeded},
+				ConditionApplied:     {metav1.ConditionTrue, ReasonSucceeded},
+			},
+			wantStatus: metav1.ConditionTrue,
+			wantReason: ReasonSucceeded,
+		},
+		{
+			name:  "first false condition wins",
+			phase: PhaseFailed,
+			conditions: map[string]condition{
+				ConditionSourceReady: {metav1.ConditionFalse, ReasonDownloadFailed},
+				ConditionApplied:     {metav1.ConditionFalse, ReasonApplyFailed},
+			},
+			err:        errors.New("download failed"),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonDownloadFailed,
+		},
+		{
+			name:  "stages after the failed one are unknown",
+			phase: PhaseFailed,
+			conditions: map[string]condition{
+				ConditionDependenciesReady: {metav1.ConditionTrue, ReasonSucceeded},
+				ConditionSourceReady:       {metav1.ConditionFalse, ReasonValuesResolveFailed},
+				ConditionRendered:          {metav1.ConditionTrue, ReasonSucceeded},
+				ConditionApplied:           {metav1.ConditionTrue, ReasonSucceeded},
+				ConditionHealthy:           {metav1.ConditionFalse, ReasonDegraded},
+			},
+			err:        errors.New("values resolve failed"),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonValuesResolveFailed,
+			wantStages: map[string]metav1.ConditionStatus{
+				ConditionDependenciesReady: metav1.ConditionTrue,
+				ConditionRendered:          metav1.ConditionUnknown,
+				ConditionApplied:           metav1.ConditionUnknown,
+				ConditionHealthy:           metav1.ConditionUnknown,
+			},
+		},
+		{
+			name:  "stages not reached are not the cause",
+			phase: PhaseFailed,
+			conditions: map[string]condition{
+				ConditionSourceReady: {metav1.ConditionTrue, ReasonSucceeded},
+				ConditionRendered:    {metav1.ConditionUnknown, ReasonNotReached},
+				ConditionApplied:     {metav1.ConditionFalse, ReasonApplyFailed},
+			},
+			err:        errors.New("apply failed"),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonApplyFailed,
+		},
+		{
+			name:       "disabled",
+			phase:      PhaseDisabled,
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonDisabled,
+		},
+		{
+			name:       "error without conditions",
+			phase:      PhaseFailed,
+			err:        errors.New("unknown bundle kind"),
+			wantStatus: metav1.ConditionFalse,
+			wantReason: ReasonApplyFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &Bundle{Status: BundleStatus{Phase: tt.phase}}
+			for k, v := range tt.conditions {
+				b.SetCondition(k, v.status, v.reason, "")
+			}
+			b.SetReadyCondition(tt.err)
+			cond := b.GetCondition(ConditionReady)
+			if cond == nil {
+				t.Fatal("Ready condition not set")
+			}
+			if cond.Status != tt.wantStatus || cond.Reason != tt.wantReason {
+				t.Errorf("SetReadyCondition() = %s/%s, want %s/%s", cond.Status, cond.Reason, tt.wantStatus, tt.wantReason)
+			}
+			for k, want := range tt.wantStages {
+				if got := b.GetCondition(k); got == nil || got.Status != want {
+					t.Errorf("condition %s = %v, want %s", k, got, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+package v1beta1
+
+// Hub marks v1beta1 as the conversion hub, it is the storage version of bundles.
+func (*Bundle) Hub() {}
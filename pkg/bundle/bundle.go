@@ -2,14 +2,17 @@ package bundle
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
-	"kubegems.io/bundle-controller/pkg/bundle/helm"
-	"kubegems.io/bundle-controller/pkg/bundle/kustomize"
-	"kubegems.io/bundle-controller/pkg/bundle/native"
-	"kubegems.io/bundle-controller/pkg/bundle/template"
+	"kubegems.io/bundle-controller/pkg/metrics"
+	"kubegems.io/bundle-controller/pkg/utils"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
@@ -20,59 +23,291 @@ type Apply interface {
 }
 
 type BundleApplier struct {
-	Options  *Options
-	appliers map[bundlev1.BundleKind]Apply
+	Options *Options
+	// Client is the client of the cluster the controller runs in, bundles and their references are read by it.
+	Client   client.Client
+	local    *Cluster
+	clusters clusters
 }
 
 type Options struct {
 	CacheDir   string
 	SearchDirs []string
+	// SearchFS is a list of extra filesystems to search bundles in,
+	// eg. an embed.FS contains built-in bundles, searched after SearchDirs.
+	SearchFS []fs.FS
+	// Timeout is the default max duration of each phase of a bundle, 0 for no timeout.
+	Timeout time.Duration
+	// RequireServiceAccount refuses to apply bundles without .spec.serviceAccountName,
+	// so bundles can't be applied by the controller's identity in multi-tenant clusters.
+	RequireServiceAccount bool
 }
 
 func NewDefaultOptions() *Options {
-	return &Options{}
+	return &Options{Timeout: DefaultTimeout}
+}
+
+// DefaultTimeout is the default timeout of each phase of download, render and apply, or remove.
+const DefaultTimeout = 10 * time.Minute
+
+// TimeoutError is returned when a phase of bundle is not finished in timeout.
+type TimeoutError struct {
+	Phase   string
+	Timeout time.Duration
+	Err     error
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.Phase, e.Timeout, e.Err)
+}
+
+func (e TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports a TimeoutError as context.DeadlineExceeded, whatever the error it wraps.
+func (e TimeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// timeout returns the timeout of each phase of bundle.
+func (b *BundleApplier) timeout(bundle *bundlev1.Bundle) time.Duration {
+	if bundle.Spec.Timeout != nil {
+		return bundle.Spec.Timeout.Duration
+	}
+	return b.Options.Timeout
+}
+
+// runPhase runs fn with the timeout of bundle, a TimeoutError is returned if the timeout exceeded.
+func (b *BundleApplier) runPhase(ctx context.Context, bundle *bundlev1.Bundle, phase string, fn func(ctx context.Context) error) error {
+	timeout := b.timeout(bundle)
+	if timeout <= 0 {
+		return fn(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err := fn(ctx); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return TimeoutError{Phase: phase, Timeout: timeout, Err: err}
+		}
+		return err
+	}
+	return nil
+}
+
+// SearchFileSystems returns all filesystems to search bundles in.
+func (o *Options) SearchFileSystems() []fs.FS {
+	fss := make([]fs.FS, 0, len(o.SearchDirs)+len(o.SearchFS))
+	for _, dir := range o.SearchDirs {
+		fss = append(fss, DirFS(dir))
+	}
+	return append(fss, o.SearchFS...)
 }
 
 func NewDefaultApply(cfg *rest.Config, cli client.Client, options *Options) *BundleApplier {
 	return &BundleApplier{
 		Options: options,
-		appliers: map[bundlev1.BundleKind]Apply{
-			bundlev1.BundleKindHelm:      helm.New(cfg),
-			bundlev1.BundleKindKustomize: native.New(cli, kustomize.KustomizeBuildFunc),
-			bundlev1.BundleKindTemplate:  native.New(cli, template.NewTemplaterFunc(cfg)),
-		},
+		Client:  cli,
+		local:   NewCluster(cfg, cli, nil),
 	}
 }
 
 func (b *BundleApplier) Template(ctx context.Context, bundle *bundlev1.Bundle) ([]byte, error) {
+	if err := b.checkServiceAccount(bundle); err != nil {
+		return nil, err
+	}
 	into, err := b.Download(ctx, bundle)
 	if err != nil {
 		return nil, fmt.Errorf("download: %w", err)
 	}
-	if apply, ok := b.appliers[bundle.Spec.Kind]; ok {
-		return apply.Template(ctx, bundle, into)
+	apply, _, err := b.applierOf(ctx, bundle)
+	if err != nil {
+		return nil, err
 	}
-	return nil, fmt.Errorf("unknown bundle kind: %s", bundle.Spec.Kind)
+	var rendered []byte
+	err = b.runPhase(ctx, bundle, "render", func(ctx context.Context) error {
+		rendered, err = apply.Template(ctx, bundle, into)
+		return err
+	})
+	return rendered, err
 }
 
 func (b *BundleApplier) Download(ctx context.Context, bundle *bundlev1.Bundle) (string, error) {
-	return Download(ctx, bundle, b.Options.CacheDir, b.Options.SearchDirs...)
+	defer metrics.ObserveSince(metrics.DownloadDuration.With(metrics.BundleLabels(bundle)), time.Now())
+	var into string
+	err := b.runPhase(ctx, bundle, "download", func(ctx context.Context) error {
+		var err error
+		if len(bundle.Spec.ContentFrom) > 0 {
+			into, err = DownloadContentFrom(ctx, b.Client, bundle, cacheDirOrDefault(b.Options.CacheDir))
+		} else {
+			into, err = Download(ctx, bundle, b.Options.CacheDir, b.Options.SearchFileSystems()...)
+		}
+		return err
+	})
+	return into, err
 }
 
 func (b *BundleApplier) Apply(ctx context.Context, bundle *bundlev1.Bundle) error {
+	if err := b.checkServiceAccount(bundle); err != nil {
+		return err
+	}
+	if err := checkRetries(bundle); err != nil {
+		return err
+	}
 	into, err := b.Download(ctx, bundle)
 	if err != nil {
+		reason := bundlev1.ReasonDownloadFailed
+		if errors.As(err, &TimeoutError{}) {
+			reason = bundlev1.ReasonTimeout
+		}
+		bundle.SetCondition(bundlev1.ConditionSourceReady, metav1.ConditionFalse, reason, err.Error())
 		return fmt.Errorf("download: %w", err)
 	}
-	if apply, ok := b.appliers[bundle.Spec.Kind]; ok {
+	bundle.SetCondition(bundlev1.ConditionSourceReady, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
+	apply, cluster, err := b.applierOf(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	phase := bundle.Status.Phase
+	start := time.Now()
+	err = b.runPhase(ctx, bundle, "apply", func(ctx context.Context) error {
 		return apply.Apply(ctx, bundle, into)
+	})
+	metrics.ObserveSince(metrics.ApplyDuration.With(metrics.BundleLabels(bundle)), start)
+	if err != nil {
+		if errors.As(err, &TimeoutError{}) {
+			// the phase timed out is the first not succeeded one
+			condition := bundlev1.ConditionApplied
+			if cond := bundle.GetCondition(bundlev1.ConditionRendered); cond != nil && cond.Status == metav1.ConditionFalse {
+				condition = bundlev1.ConditionRendered
+			}
+			bundle.SetCondition(condition, metav1.ConditionFalse, bundlev1.ReasonTimeout, err.Error())
+		}
+		return b.remediate(ctx, apply, bundle, err)
+	}
+	if err := b.checkHealth(ctx, cluster.Client, bundle, phase); err != nil {
+		if errors.As(err, &DegradedError{}) {
+			return b.remediate(ctx, apply, bundle, err)
+		}
+		return err
+	}
+	if bundle.Status.Health == bundlev1.HealthStatusHealthy {
+		if status := bundle.Status.Remediation; status != nil {
+			status.Failures = 0
+		}
+		if committer, ok := apply.(SnapshotCommitter); ok {
+			if err := committer.CommitSnapshot(ctx, bundle); err != nil {
+				return fmt.Errorf("commit snapshot: %w", err)
+			}
+		}
+		if bundle.Status.Phase == bundlev1.PhaseInstalled {
+			if err := b.exportOutputs(ctx, cluster.Client, bundle); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// DegradedError is returned when applied resources are degraded.
+type DegradedError struct {
+	Message string
+}
+
+func (e DegradedError) Error() string {
+	return "degraded: " + e.Message
+}
+
+// checkHealth sets the health of applied bundle, the bundle is installed only if it is healthy.
+// A progressing bundle is installing or upgrading until it is healthy, a degraded bundle is failed.
+func (b *BundleApplier) checkHealth(ctx context.Context, cli client.Client, bundle *bundlev1.Bundle, phase bundlev1.Phase) error {
+	// namespace is ignored by client for cluster scoped resources
+	resources := make([]corev1.ObjectReference, len(bundle.Status.Resources))
+	for i, ref := range bundle.Status.Resources {
+		if ref.Namespace == "" {
+			ref.Namespace = bundle.Status.Namespace
+		}
+		resources[i] = ref
+	}
+	checks := make([]bundlev1.HealthCheck, len(bundle.Spec.HealthChecks))
+	for i, check := range bundle.Spec.HealthChecks {
+		if check.Namespace == "" {
+			check.Namespace = bundle.Status.Namespace
+		}
+		checks[i] = check
+	}
+	checker := &utils.HealthChecker{Client: cli}
+	health, err := checker.Check(ctx, resources, checks)
+	if err != nil {
+		bundle.SetCondition(bundlev1.ConditionHealthy, metav1.ConditionFalse, bundlev1.ReasonHealthCheckFailed, err.Error())
+		return fmt.Errorf("health check: %w", err)
+	}
+	bundle.Status.Health = health.Status
+	switch health.Status {
+	case bundlev1.HealthStatusProgressing:
+		bundle.SetCondition(bundlev1.ConditionHealthy, metav1.ConditionFalse, bundlev1.ReasonProgressing, health.Message)
+		bundle.Status.Phase = progressingPhase(bundle, phase)
+		bundle.Status.Message = health.Message
+		return nil
+	case bundlev1.HealthStatusDegraded:
+		bundle.SetCondition(bundlev1.ConditionHealthy, metav1.ConditionFalse, bundlev1.ReasonDegraded, health.Message)
+		return DegradedError{Message: health.Message}
+	default:
+		bundle.SetCondition(bundlev1.ConditionHealthy, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
+		return nil
 	}
-	return fmt.Errorf("unknown bundle kind: %s", bundle.Spec.Kind)
+}
+
+// progressingPhase returns the phase of an applied bundle whose resources are not ready yet,
+// phase is the one before apply, a previous phase like Failed is not kept.
+func progressingPhase(bundle *bundlev1.Bundle, phase bundlev1.Phase) bundlev1.Phase {
+	switch {
+	case phase == bundlev1.PhaseInstalling || phase == bundlev1.PhaseUpgrading:
+		return phase
+	case bundle.Status.CreationTimestamp.Equal(&bundle.Status.UpgradeTimestamp):
+		return bundlev1.PhaseInstalling
+	default:
+		return bundlev1.PhaseUpgrading
+	}
+}
+
+// Orphaner is implemented by appliers can leave the installed resources and remove the bookkeeping only.
+type Orphaner interface {
+	Orphan(ctx context.Context, bundle *bundlev1.Bundle) error
+}
+
+// Orphan removes the bundle but keeps its installed resources in cluster.
+func (b *BundleApplier) Orphan(ctx context.Context, bundle *bundlev1.Bundle) error {
+	apply, _, err := b.applierOf(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	if orphaner, ok := apply.(Orphaner); ok {
+		if err := orphaner.Orphan(ctx, bundle); err != nil {
+			return err
+		}
+	}
+	if orphaned := len(bundle.Status.Resources); orphaned > 0 {
+		utils.EventRecorderFromContextOrDiscard(ctx).Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonOrphaned, "orphaned %d resources", orphaned)
+	}
+	bundle.Status.Resources = nil
+	bundle.Status.Phase = bundlev1.PhaseDisabled
+	bundle.Status.Health = ""
+	bundle.RemoveCondition(bundlev1.ConditionHealthy)
+	return nil
 }
 
 func (b *BundleApplier) Remove(ctx context.Context, bundle *bundlev1.Bundle) error {
-	if apply, ok := b.appliers[bundle.Spec.Kind]; ok {
+	apply, _, err := b.applierOf(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	if err := b.runPhase(ctx, bundle, "remove", func(ctx context.Context) error {
 		return apply.Remove(ctx, bundle)
+	}); err != nil {
+		return err
 	}
-	return fmt.Errorf("unknown bundle kind: %s", bundle.Spec.Kind)
+	bundle.Status.Health = ""
+	bundle.RemoveCondition(bundlev1.ConditionHealthy)
+	return nil
 }
@@ -0,0 +1,50 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+)
+
+func TestTimeoutError(t *testing.T) {
+	err := error(TimeoutError{Phase: "render", Timeout: time.Second, Err: fs.ErrNotExist})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("TimeoutError is not context.DeadlineExceeded")
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("TimeoutError does not wrap the inner error")
+	}
+	if !errors.As(err, &TimeoutError{}) {
+		t.Error("TimeoutError is not a TimeoutError")
+	}
+}
+
+func TestProgressingPhase(t *testing.T) {
+	installed := metav1.NewTime(time.Now().Add(-time.Hour))
+	upgraded := metav1.Now()
+	tests := []struct {
+		name     string
+		phase    bundlev1.Phase
+		creation metav1.Time
+		want     bundlev1.Phase
+	}{
+		{name: "installing", phase: bundlev1.PhaseInstalling, creation: upgraded, want: bundlev1.PhaseInstalling},
+		{name: "upgrading", phase: bundlev1.PhaseUpgrading, creation: installed, want: bundlev1.PhaseUpgrading},
+		{name: "retry of failed install", phase: bundlev1.PhaseFailed, creation: upgraded, want: bundlev1.PhaseInstalling},
+		{name: "retry of failed upgrade", phase: bundlev1.PhaseFailed, creation: installed, want: bundlev1.PhaseUpgrading},
+		{name: "installed", phase: bundlev1.PhaseInstalled, creation: installed, want: bundlev1.PhaseUpgrading},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := &bundlev1.Bundle{Status: bundlev1.BundleStatus{CreationTimestamp: tt.creation, UpgradeTimestamp: upgraded}}
+			if got := progressingPhase(bundle, tt.phase); got != tt.want {
+				t.Errorf("progressingPhase() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/bundle/helm"
+	"kubegems.io/bundle-controller/pkg/bundle/kustomize"
+	"kubegems.io/bundle-controller/pkg/bundle/native"
+	"kubegems.io/bundle-controller/pkg/bundle/template"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+)
+
+// DefaultKubeConfigKey is the default key of kubeconfig in the secret of .spec.kubeConfig.secretRef.
+const DefaultKubeConfigKey = "kubeconfig"
+
+// Cluster is a cluster bundles are installed into.
+type Cluster struct {
+	Config   *rest.Config
+	Client   client.Client
+	appliers map[bundlev1.BundleKind]Apply
+}
+
+// NewCluster returns a cluster applies bundles by cfg and cli,
+// snapshots of native bundles are stored by the snapshots client.
+func NewCluster(cfg *rest.Config, cli client.Client, snapshots client.Client) *Cluster {
+	kustomizeApply := native.New(cli, kustomize.KustomizeBuildFunc)
+	kustomizeApply.Snapshots = snapshots
+	templateApply := native.New(cli, template.NewTemplaterFunc(cfg))
+	templateApply.Snapshots = snapshots
+	return &Cluster{
+		Config: cfg,
+		Client: cli,
+		appliers: map[bundlev1.BundleKind]Apply{
+			bundlev1.BundleKindHelm:      helm.New(cfg),
+			bundlev1.BundleKindKustomize: kustomizeApply,
+			bundlev1.BundleKindTemplate:  templateApply,
+		},
+	}
+}
+
+// Applier returns the applier of bundle kind.
+func (c *Cluster) Applier(kind bundlev1.BundleKind) (Apply, error) {
+	apply, ok := c.appliers[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown bundle kind: %s", kind)
+	}
+	return apply, nil
+}
+
+// clusterKey is the key of a cached cluster,
+// a zero KubeConfig is the local cluster and a zero ServiceAccount is the controller's identity.
+type clusterKey struct {
+	KubeConfig     client.ObjectKey
+	ServiceAccount client.ObjectKey
+}
+
+type cachedCluster struct {
+	resourceVersion string
+	cluster         *Cluster
+}
+
+// clusters caches remote and impersonated clusters.
+type clusters struct {
+	mu    sync.Mutex
+	items map[clusterKey]cachedCluster
+}
+
+// ErrServiceAccountRequired is returned when impersonation is required but the bundle has no service account.
+var ErrServiceAccountRequired = errors.New("serviceAccountName is required")
+
+// ImpersonateUserName returns the user name of a service account to impersonate.
+func ImpersonateUserName(namespace, name string) string {
+	return "system:serviceaccount:" + namespace + ":" + name
+}
+
+// checkServiceAccount returns ErrServiceAccountRequired if impersonation is required but the bundle has no service account.
+// It is checked only on apply and template, a bundle installed before it was required can still be removed.
+func (b *BundleApplier) checkServiceAccount(bundle *bundlev1.Bundle) error {
+	if bundle.Spec.ServiceAccountName == "" && b.Options != nil && b.Options.RequireServiceAccount {
+		return ErrServiceAccountRequired
+	}
+	return nil
+}
+
+// clusterOf returns the cluster the bundle installed into, impersonating the service account of bundle if set.
+// A remote cluster is rebuilt only when its kubeconfig secret changed.
+func (b *BundleApplier) clusterOf(ctx context.Context, bundle *bundlev1.Bundle) (*Cluster, error) {
+	if bundle.Spec.KubeConfig == nil && bundle.Spec.ServiceAccountName == "" {
+		return b.local, nil
+	}
+	if b.Client == nil {
+		return nil, errors.New("no client of the controller cluster")
+	}
+
+	key, resourceVersion, kubeconfig := clusterKey{}, "", []byte(nil)
+	if bundle.Spec.KubeConfig != nil {
+		ref := bundle.Spec.KubeConfig.SecretRef
+		key.KubeConfig = client.ObjectKey{Namespace: bundle.Namespace, Name: ref.Name}
+		secret := &corev1.Secret{}
+		if err := b.Client.Get(ctx, key.KubeConfig, secret); err != nil {
+			return nil, fmt.Errorf("kubeconfig: %w", err)
+		}
+		datakey := ref.Key
+		if datakey == "" {
+			datakey = DefaultKubeConfigKey
+		}
+		data, ok := secret.Data[datakey]
+		if !ok {
+			return nil, fmt.Errorf("kubeconfig: key %s not found in secret %s", datakey, key.KubeConfig)
+		}
+		resourceVersion, kubeconfig = secret.ResourceVersion, data
+	}
+	if sa := bundle.Spec.ServiceAccountName; sa != "" {
+		key.ServiceAccount = client.ObjectKey{Namespace: bundle.Namespace, Name: sa}
+	}
+
+	b.clusters.mu.Lock()
+	defer b.clusters.mu.Unlock()
+	if cached, ok := b.clusters.items[key]; ok && cached.resourceVersion == resourceVersion {
+		return cached.cluster, nil
+	}
+	cfg := b.local.Config
+	if kubeconfig != nil {
+		remote, err := RESTConfigFromKubeConfig(kubeconfig)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig: %w", err)
+		}
+		cfg = remote
+	}
+	if cfg == nil {
+		return nil, errors.New("no rest config of the controller cluster")
+	}
+	if sa := key.ServiceAccount; sa.Name != "" {
+		cfg = rest.CopyConfig(cfg)
+		cfg.Impersonate = rest.ImpersonationConfig{UserName: ImpersonateUserName(sa.Namespace, sa.Name)}
+	}
+	// discovery is deferred to the first request, so an unreachable cluster doesn't block here
+	mapper, err := apiutil.NewDynamicRESTMapper(cfg, apiutil.WithLazyDiscovery)
+	if err != nil {
+		return nil, err
+	}
+	cli, err := client.New(cfg, client.Options{Scheme: b.Client.Scheme(), Mapper: mapper})
+	if err != nil {
+		return nil, err
+	}
+	// snapshots are bookkeeping of the controller, always stored by its own client
+	cluster := NewCluster(cfg, cli, b.Client)
+	if b.clusters.items == nil {
+		b.clusters.items = map[clusterKey]cachedCluster{}
+	}
+	b.clusters.items[key] = cachedCluster{resourceVersion: resourceVersion, cluster: cluster}
+	return cluster, nil
+}
+
+// RESTConfigFromKubeConfig returns the rest config of a kubeconfig provided by tenants.
+// Only inline credentials are allowed, exec and auth provider plugins and file references are rejected,
+// so a kubeconfig can't run commands in or read files from the controller.
+func RESTConfigFromKubeConfig(data []byte) (*rest.Config, error) {
+	config, err := clientcmd.Load(data)
+	if err != nil {
+		return nil, err
+	}
+	for name, cluster := range config.Clusters {
+		if cluster.CertificateAuthority != "" {
+			return nil, fmt.Errorf("cluster %s: certificate-authority file is not allowed, use certificate-authority-data", name)
+		}
+	}
+	for name, user := range config.AuthInfos {
+		switch {
+		case user.Exec != nil:
+			return nil, fmt.Errorf("user %s: exec is not allowed", name)
+		case user.AuthProvider != nil:
+			return nil, fmt.Errorf("user %s: auth-provider is not allowed", name)
+		case user.TokenFile != "":
+			return nil, fmt.Errorf("user %s: tokenFile is not allowed, use token", name)
+		case user.ClientCertificate != "" || user.ClientKey != "":
+			return nil, fmt.Errorf("user %s: client-certificate and client-key files are not allowed, use client-certificate-data and client-key-data", name)
+		}
+	}
+	return clientcmd.NewDefaultClientConfig(*config, &clientcmd.ConfigOverrides{}).ClientConfig()
+}
+
+// applierOf returns the applier of bundle and the cluster it applies into.
+func (b *BundleApplier) applierOf(ctx context.Context, bundle *bundlev1.Bundle) (Apply, *Cluster, error) {
+	cluster, err := b.clusterOf(ctx, bundle)
+	if err != nil {
+		return nil, nil, err
+	}
+	apply, err := cluster.Applier(bundle.Spec.Kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	return apply, cluster, nil
+}
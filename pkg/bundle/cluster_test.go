@@ -0,0 +1,141 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestClusterOf(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "remote"},
+		Data:       map[string][]byte{"config": []byte("invalid")},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+	b := NewDefaultApply(nil, cli, NewDefaultOptions())
+
+	bundle := &bundlev1.Bundle{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}}
+	if cluster, err := b.clusterOf(context.Background(), bundle); err != nil || cluster != b.local {
+		t.Errorf("clusterOf() = %v, %v, want local cluster", cluster, err)
+	}
+
+	bundle.Spec.KubeConfig = &bundlev1.KubeConfig{SecretRef: bundlev1.SecretKeyReference{Name: "remote"}}
+	if _, err := b.clusterOf(context.Background(), bundle); err == nil {
+		t.Error("clusterOf() with missing key = nil, want error")
+	}
+	bundle.Spec.KubeConfig.SecretRef.Key = "config"
+	if _, err := b.clusterOf(context.Background(), bundle); err == nil {
+		t.Error("clusterOf() with invalid kubeconfig = nil, want error")
+	}
+}
+
+func TestRequireServiceAccount(t *testing.T) {
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).Build()
+	options := NewDefaultOptions()
+	options.RequireServiceAccount = true
+	b := NewDefaultApply(nil, cli, options)
+
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Spec:       bundlev1.BundleSpec{Kind: bundlev1.BundleKindKustomize},
+	}
+	if err := b.Apply(context.Background(), bundle); !errors.Is(err, ErrServiceAccountRequired) {
+		t.Errorf("Apply() = %v, want ErrServiceAccountRequired", err)
+	}
+	if _, err := b.Template(context.Background(), bundle); !errors.Is(err, ErrServiceAccountRequired) {
+		t.Errorf("Template() = %v, want ErrServiceAccountRequired", err)
+	}
+	// installed before a service account was required
+	if err := b.Remove(context.Background(), bundle); err != nil {
+		t.Errorf("Remove() = %v, want nil", err)
+	}
+	if err := b.Orphan(context.Background(), bundle); err != nil {
+		t.Errorf("Orphan() = %v, want nil", err)
+	}
+}
+
+const testKubeConfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: remote
+  cluster:
+    server: https://remote.example.com
+contexts:
+- name: remote
+  context:
+    cluster: remote
+    user: remote
+current-context: remote
+users:
+- name: remote
+  user:
+`
+
+func TestRESTConfigFromKubeConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		user    string
+		cluster string
+		wantErr bool
+	}{
+		{name: "inline token", user: "    token: abc\n"},
+		{name: "exec", user: "    exec:\n      apiVersion: client.authentication.k8s.io/v1beta1\n      command: /bin/sh\n", wantErr: true},
+		{name: "auth provider", user: "    auth-provider:\n      name: gcp\n", wantErr: true},
+		{name: "token file", user: "    tokenFile: /var/run/secrets/kubernetes.io/serviceaccount/token\n", wantErr: true},
+		{name: "client certificate file", user: "    client-certificate: /etc/tls.crt\n    client-key: /etc/tls.key\n", wantErr: true},
+		{name: "certificate authority file", user: "    token: abc\n", cluster: "    certificate-authority: /etc/ca.crt\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kubeconfig := strings.Replace(testKubeConfig, "    server: https://remote.example.com\n",
+				"    server: https://remote.example.com\n"+tt.cluster, 1) + tt.user
+			_, err := RESTConfigFromKubeConfig([]byte(kubeconfig))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("RESTConfigFromKubeConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClusterOfCache(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "remote"},
+		Data:       map[string][]byte{DefaultKubeConfigKey: []byte(testKubeConfig + "    token: abc\n")},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(secret).Build()
+	b := NewDefaultApply(nil, cli, NewDefaultOptions())
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Spec:       bundlev1.BundleSpec{KubeConfig: &bundlev1.KubeConfig{SecretRef: bundlev1.SecretKeyReference{Name: "remote"}}},
+	}
+
+	first, err := b.clusterOf(context.Background(), bundle)
+	if err != nil {
+		t.Fatalf("clusterOf() error = %v", err)
+	}
+	if cached, err := b.clusterOf(context.Background(), bundle); err != nil || cached != first {
+		t.Errorf("clusterOf() = %p, %v, want cached %p", cached, err, first)
+	}
+
+	secret.Data[DefaultKubeConfigKey] = []byte(testKubeConfig + "    token: def\n")
+	if err := cli.Update(context.Background(), secret); err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, err := b.clusterOf(context.Background(), bundle)
+	if err != nil {
+		t.Fatalf("clusterOf() error = %v", err)
+	}
+	if rebuilt == first {
+		t.Error("clusterOf() returned the cached cluster after the kubeconfig secret changed")
+	}
+	if rebuilt.Config.BearerToken != "def" {
+		t.Errorf("clusterOf() token = %s, want def", rebuilt.Config.BearerToken)
+	}
+}
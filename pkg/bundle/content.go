@@ -0,0 +1,91 @@
+package bundle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DownloadContentFrom materializes the files in bundle's .spec.contentFrom into cache directory.
+// The directory is rebuilt on each call, so changes of the referenced resources take effect.
+func DownloadContentFrom(ctx context.Context, cli client.Client, bundle *bundlev1.Bundle, cachedir string) (string, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	if cli == nil {
+		return "", fmt.Errorf("contentFrom requires a kubernetes client")
+	}
+
+	into := filepath.Join(cachedir, "contents", bundle.Namespace, bundle.Name)
+	if err := os.RemoveAll(into); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(into, defaultDirMode); err != nil {
+		return "", err
+	}
+	log.Info("writing contents", "cache", into)
+
+	for _, ref := range bundle.Spec.ContentFrom {
+		files := map[string][]byte{}
+		switch strings.ToLower(ref.Kind) {
+		case "secret", "secrets":
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: bundle.Namespace}}
+			if err := cli.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+				return "", err
+			}
+			for k, v := range secret.Data {
+				files[k] = v
+			}
+		case "configmap", "configmaps":
+			configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: bundle.Namespace}}
+			if err := cli.Get(ctx, client.ObjectKeyFromObject(configmap), configmap); err != nil {
+				return "", err
+			}
+			for k, v := range configmap.BinaryData {
+				files[k] = v
+			}
+			for k, v := range configmap.Data {
+				files[k] = []byte(v)
+			}
+		default:
+			return "", fmt.Errorf("contentFrom kind [%s] is not supported", ref.Kind)
+		}
+		path, err := JoinInto(into, ref.Path)
+		if err != nil {
+			return "", fmt.Errorf("%s %s: %w", ref.Kind, ref.Name, err)
+		}
+		if err := writeContents(files, path); err != nil {
+			return "", fmt.Errorf("write %s %s: %w", ref.Kind, ref.Name, err)
+		}
+	}
+	return into, nil
+}
+
+func writeContents(files map[string][]byte, into string) error {
+	if err := os.MkdirAll(into, defaultDirMode); err != nil {
+		return err
+	}
+	for name, content := range files {
+		if strings.HasSuffix(name, ".tgz") || strings.HasSuffix(name, ".tar.gz") {
+			if err := UnTarGz(bytes.NewReader(content), "", into); err != nil {
+				return err
+			}
+			continue
+		}
+		filename, err := JoinInto(into, name)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filename, content, defaultFileMode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
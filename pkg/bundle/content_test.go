@@ -0,0 +1,94 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func tarGz(t *testing.T, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gz := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestDownloadContentFrom(t *testing.T) {
+	configmap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "files"},
+		Data:       map[string]string{"Chart.yaml": "name: demo"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "templates"},
+		Data:       map[string][]byte{"templates.tgz": tarGz(t, map[string]string{"deployment.yaml": "kind: Deployment"})},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(configmap, secret).Build()
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "demo"},
+		Spec: bundlev1.BundleSpec{ContentFrom: []bundlev1.ContentFrom{
+			{Kind: "ConfigMap", Name: "files"},
+			{Kind: "Secret", Name: "templates", Path: "templates"},
+		}},
+	}
+
+	cachedir := t.TempDir()
+	into, err := DownloadContentFrom(context.Background(), cli, bundle, cachedir)
+	if err != nil {
+		t.Fatalf("DownloadContentFrom() error = %v", err)
+	}
+	for file, want := range map[string]string{"Chart.yaml": "name: demo", "templates/deployment.yaml": "kind: Deployment"} {
+		got, err := os.ReadFile(filepath.Join(into, file))
+		if err != nil || string(got) != want {
+			t.Errorf("file %s = %q, %v, want %q", file, got, err, want)
+		}
+	}
+
+	bundle.Spec.ContentFrom[1].Path = "../../escaped"
+	if _, err := DownloadContentFrom(context.Background(), cli, bundle, cachedir); err == nil {
+		t.Error("DownloadContentFrom() with path outside of bundle = nil, want error")
+	}
+	if _, err := os.Stat(filepath.Join(cachedir, "contents", "escaped")); !os.IsNotExist(err) {
+		t.Errorf("file written outside of bundle, stat error = %v", err)
+	}
+}
+
+func TestWriteContentsOutside(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string][]byte
+	}{
+		{name: "file name", files: map[string][]byte{"../escaped": []byte("escaped")}},
+		{name: "tar entry", files: map[string][]byte{"evil.tgz": tarGz(t, map[string]string{"../escaped": "escaped"})}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if err := writeContents(tt.files, filepath.Join(dir, "bundle")); err == nil {
+				t.Error("writeContents() = nil, want error")
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escaped")); !os.IsNotExist(err) {
+				t.Errorf("file written outside of bundle, stat error = %v", err)
+			}
+		})
+	}
+}
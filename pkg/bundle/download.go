@@ -6,6 +6,8 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"io/fs"
@@ -15,6 +17,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
@@ -22,8 +25,10 @@ import (
 	"github.com/go-git/go-git/v5/storage/memory"
 	"github.com/go-logr/logr"
 	"helm.sh/helm/v3/pkg/chart"
+	corev1 "k8s.io/api/core/v1"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
 	"kubegems.io/bundle-controller/pkg/bundle/helm"
+	"kubegems.io/bundle-controller/pkg/utils"
 )
 
 const (
@@ -32,12 +37,11 @@ const (
 )
 
 // we cache "bundle" in a directory with name "{name}-{version}" under cache directory
-func Download(ctx context.Context, bundle *bundlev1.Bundle, cachedir string, searchdirs ...string) (string, error) {
+// searchfs are searched before the cache, a bundle found in a non local filesystem (eg. embed.FS)
+// is copied into cache directory first.
+func Download(ctx context.Context, bundle *bundlev1.Bundle, cachedir string, searchfs ...fs.FS) (string, error) {
 	log := logr.FromContextOrDiscard(ctx)
-	if cachedir == "" {
-		home, _ := os.UserHomeDir()
-		cachedir = filepath.Join(home, ".cache", "kubegems", "bundles")
-	}
+	cachedir = cacheDirOrDefault(cachedir)
 
 	name, version := getCacheNameVersion(bundle)
 
@@ -48,24 +52,33 @@ func Download(ctx context.Context, bundle *bundlev1.Bundle, cachedir string, sea
 		searchname = name
 	}
 	// from searchdirs
-	for _, dir := range searchdirs {
-		if foundpath := findAt(filepath.Join(dir, searchname)); foundpath != "" {
-			log.Info("found in search path", "path", foundpath)
-			if bundle.Spec.Kind == bundlev1.BundleKindHelm || bundle.Spec.Kind == bundlev1.BundleKindTemplate {
-				if _, chart, err := helm.LoadChart(ctx, foundpath, "", ""); err != nil {
-					return "", err
-				} else if meta := chart.Metadata; meta != nil {
-					bundle.Status.AppVersion = meta.AppVersion
-					bundle.Status.Version = meta.Version
-				}
+	for _, fsys := range searchfs {
+		foundpath, err := findInFS(fsys, searchname, cachedir)
+		if err != nil {
+			return "", err
+		}
+		if foundpath == "" {
+			continue
+		}
+		log.Info("found in search path", "path", foundpath)
+		if bundle.Spec.Kind == bundlev1.BundleKindHelm || bundle.Spec.Kind == bundlev1.BundleKindTemplate {
+			if _, chart, err := helm.LoadChart(ctx, foundpath, "", ""); err != nil {
+				return "", err
+			} else if meta := chart.Metadata; meta != nil {
+				bundle.Status.AppVersion = meta.AppVersion
+				bundle.Status.Version = meta.Version
 			}
-			return foundpath, nil
 		}
+		return foundpath, nil
 	}
 
 	// from cache
 	if version == "" {
-		return "", fmt.Errorf("not found in search pathes and no version specified")
+		if bundle.Spec.URL == "" || IsHelmRepository(bundle) {
+			return "", fmt.Errorf("not found in search pathes and no version specified")
+		}
+		// an archive or git repository without version is cached by its source
+		version = sourceHash(bundle)
 	}
 	versionedPath := fmt.Sprintf("%s-%s", name, version)
 	fullVersionedPath := filepath.Join(cachedir, versionedPath)
@@ -85,7 +98,15 @@ func Download(ctx context.Context, bundle *bundlev1.Bundle, cachedir string, sea
 
 	into := fullVersionedPath
 	log.Info("downloading...", "cache", into)
+	path, err := download(ctx, bundle, repo, name, version, into)
+	if err != nil {
+		return "", err
+	}
+	utils.EventRecorderFromContextOrDiscard(ctx).Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonDownloaded, "downloaded %s %s", repo, version)
+	return path, nil
+}
 
+func download(ctx context.Context, bundle *bundlev1.Bundle, repo, name, version, into string) (string, error) {
 	// is file://
 	if strings.HasPrefix(repo, "file://") {
 		return into, DownloadFile(ctx, repo, bundle.Spec.Path, into)
@@ -117,6 +138,34 @@ func Download(ctx context.Context, bundle *bundlev1.Bundle, cachedir string, sea
 	return "", fmt.Errorf("unknown download source")
 }
 
+// IsHelmRepository returns true if the bundle is downloaded from a helm repository, which requires a version.
+func IsHelmRepository(bundle *bundlev1.Bundle) bool {
+	repo := bundle.Spec.URL
+	if bundle.Spec.Kind != bundlev1.BundleKindHelm || repo == "" || strings.HasPrefix(repo, "file://") {
+		return false
+	}
+	for _, suffix := range []string{".git", ".zip", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(repo, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// sourceHash returns a short hash of url and path of bundle.
+func sourceHash(bundle *bundlev1.Bundle) string {
+	sum := sha256.Sum256([]byte(bundle.Spec.URL + "#" + bundle.Spec.Path))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func cacheDirOrDefault(cachedir string) string {
+	if cachedir == "" {
+		home, _ := os.UserHomeDir()
+		cachedir = filepath.Join(home, ".cache", "kubegems", "bundles")
+	}
+	return cachedir
+}
+
 func getCacheNameVersion(bundle *bundlev1.Bundle) (string, string) {
 	version := bundle.Spec.Version
 	name := bundle.Spec.Chart
@@ -347,8 +396,10 @@ func UnTarGz(r io.Reader, subpath, into string) error {
 			continue
 		}
 
-		filename := strings.TrimPrefix(hdr.Name, subpath)
-		filename = filepath.Join(into, filename)
+		filename, err := JoinInto(into, strings.TrimPrefix(hdr.Name, subpath))
+		if err != nil {
+			return err
+		}
 
 		if hdr.FileInfo().IsDir() {
 			if err := os.MkdirAll(filename, defaultDirMode); err != nil {
@@ -372,6 +423,16 @@ func UnTarGz(r io.Reader, subpath, into string) error {
 	return nil
 }
 
+// JoinInto joins name to directory into, name must not escape into after cleaned.
+func JoinInto(into, name string) (string, error) {
+	joined := filepath.Join(into, name)
+	rel, err := filepath.Rel(into, joined)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of %s", name, into)
+	}
+	return joined, nil
+}
+
 func findAt(path string) string {
 	if tgzfile, ok := hasTgz(path); ok {
 		return tgzfile
@@ -395,3 +456,125 @@ func hasTgz(path string) (string, bool) {
 	}
 	return path, false
 }
+
+// DirFS returns a filesystem of local directory dir.
+// Bundles found in it are used in place instead of copying into cache directory.
+func DirFS(dir string) fs.FS {
+	return localFS{FS: os.DirFS(dir), dir: dir}
+}
+
+type localFS struct {
+	fs.FS
+	dir string
+}
+
+// findInFS find bundle "name" in fsys, returns the local path of the bundle.
+// If fsys is not a local directory, the found bundle is copied into cachedir.
+func findInFS(fsys fs.FS, name string, cachedir string) (string, error) {
+	if local, ok := fsys.(localFS); ok {
+		return findAt(filepath.Join(local.dir, name)), nil
+	}
+	for _, tgz := range []string{name + ".tgz", name + ".tar.gz"} {
+		if fi, err := fs.Stat(fsys, tgz); err != nil || fi.IsDir() {
+			continue
+		}
+		into := filepath.Join(cachedir, tgz)
+		return into, fsCopies.copyOnce(into, func() error { return CopyFileFromFS(fsys, tgz, into) })
+	}
+	if fi, err := fs.Stat(fsys, name); err != nil || !fi.IsDir() {
+		return "", nil
+	}
+	into := filepath.Join(cachedir, name)
+	return into, fsCopies.copyOnce(into, func() error { return CopyDirFromFS(fsys, name, into) })
+}
+
+// fsCopies records bundles copied from non local filesystems.
+// Those filesystems (eg. embed.FS) do not change while running, so a bundle is copied once,
+// a copy left by a previous run may be stale and is replaced.
+var fsCopies = &fsCopyCache{copied: map[string]bool{}}
+
+type fsCopyCache struct {
+	mu     sync.Mutex
+	copied map[string]bool
+}
+
+// copyOnce runs copy into local path into if not copied yet, copies are serialised.
+func (c *fsCopyCache) copyOnce(into string, copy func() error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.copied[into] {
+		if _, err := os.Stat(into); err == nil {
+			return nil
+		}
+	}
+	if err := copy(); err != nil {
+		return err
+	}
+	c.copied[into] = true
+	return nil
+}
+
+// CopyFileFromFS copy file src in fsys to local file into.
+// The file is written to a temporary file and renamed into, readers never see a partial file.
+func CopyFileFromFS(fsys fs.FS, src, into string) error {
+	f, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := os.MkdirAll(filepath.Dir(into), defaultDirMode); err != nil {
+		return err
+	}
+	dest, err := os.CreateTemp(filepath.Dir(into), "."+filepath.Base(into)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(dest.Name())
+
+	if _, err := io.Copy(dest, f); err != nil {
+		dest.Close()
+		return err
+	}
+	if err := dest.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(dest.Name(), defaultFileMode); err != nil {
+		return err
+	}
+	return os.Rename(dest.Name(), into)
+}
+
+// CopyDirFromFS copy directory src in fsys to local directory into.
+// The directory is copied to a temporary directory and replaces into, files not in src are removed.
+func CopyDirFromFS(fsys fs.FS, src, into string) error {
+	if err := os.MkdirAll(filepath.Dir(into), defaultDirMode); err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(into), "."+filepath.Base(into)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := fs.WalkDir(fsys, src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relpath := strings.TrimPrefix(strings.TrimPrefix(path, src), "/")
+		filename := filepath.Join(tmp, filepath.FromSlash(relpath))
+		if d.IsDir() {
+			return os.MkdirAll(filename, defaultDirMode)
+		}
+		return CopyFileFromFS(fsys, path, filename)
+	}); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp, defaultDirMode); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(into); err != nil {
+		return err
+	}
+	return os.Rename(tmp, into)
+}
@@ -0,0 +1,114 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFindInFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"nginx-1.0.0.tgz":                   {Data: []byte("tgz")},
+		"demo/kustomization.yaml":           {Data: []byte("resources: []")},
+		"demo/base/configmap.yaml":          {Data: []byte("kind: ConfigMap")},
+		"local-path-provisioner/Chart.yaml": {Data: []byte("name: local-path-provisioner")},
+	}
+	tests := []struct {
+		name      string
+		search    string
+		want      string
+		wantFiles []string
+	}{
+		{
+			name:      "tgz in fs",
+			search:    "nginx-1.0.0",
+			want:      "nginx-1.0.0.tgz",
+			wantFiles: []string{"nginx-1.0.0.tgz"},
+		},
+		{
+			name:      "dir in fs",
+			search:    "demo",
+			want:      "demo",
+			wantFiles: []string{"demo/kustomization.yaml", "demo/base/configmap.yaml"},
+		},
+		{
+			name:   "not found",
+			search: "foo",
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cachedir := t.TempDir()
+			got, err := findInFS(fsys, tt.search, cachedir)
+			if err != nil {
+				t.Fatalf("findInFS() error = %v", err)
+			}
+			want := tt.want
+			if want != "" {
+				want = filepath.Join(cachedir, want)
+			}
+			if got != want {
+				t.Errorf("findInFS() = %v, want %v", got, want)
+			}
+			for _, file := range tt.wantFiles {
+				if _, err := os.Stat(filepath.Join(cachedir, file)); err != nil {
+					t.Errorf("file %s not copied: %v", file, err)
+				}
+			}
+		})
+	}
+}
+
+func TestFindInFSLocalDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "demo"), defaultDirMode); err != nil {
+		t.Fatal(err)
+	}
+	got, err := findInFS(DirFS(dir), "demo", t.TempDir())
+	if err != nil {
+		t.Fatalf("findInFS() error = %v", err)
+	}
+	if want := filepath.Join(dir, "demo"); got != want {
+		t.Errorf("findInFS() = %v, want %v", got, want)
+	}
+}
+
+func TestFindInFSCopyOnce(t *testing.T) {
+	fsys := fstest.MapFS{
+		"demo/kustomization.yaml": {Data: []byte("resources: []")},
+	}
+	cachedir := t.TempDir()
+	// left by a previous run
+	stale := filepath.Join(cachedir, "demo", "stale.yaml")
+	if err := os.MkdirAll(filepath.Dir(stale), defaultDirMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(stale, []byte("kind: ConfigMap"), defaultFileMode); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findInFS(fsys, "demo", cachedir); err != nil {
+		t.Fatalf("findInFS() error = %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale file not removed: %v", err)
+	}
+	entries, _ := os.ReadDir(cachedir)
+	if len(entries) != 1 {
+		t.Errorf("cache dir entries = %d, want only the copied bundle", len(entries))
+	}
+
+	// copied once, not rewritten while it may be read
+	copied := filepath.Join(cachedir, "demo", "kustomization.yaml")
+	fi, err := os.Stat(copied)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := findInFS(fsys, "demo", cachedir); err != nil {
+		t.Fatalf("findInFS() error = %v", err)
+	}
+	if again, err := os.Stat(copied); err != nil || !os.SameFile(fi, again) {
+		t.Errorf("bundle copied again: %v", err)
+	}
+}
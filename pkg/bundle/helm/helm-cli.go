@@ -1,10 +1,12 @@
 package helm
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/go-logr/logr"
 	"golang.org/x/exp/slices"
@@ -16,10 +18,12 @@ import (
 	"helm.sh/helm/v3/pkg/getter"
 	"helm.sh/helm/v3/pkg/kube"
 	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/releaseutil"
 	"helm.sh/helm/v3/pkg/storage"
 	"helm.sh/helm/v3/pkg/storage/driver"
 	"k8s.io/cli-runtime/pkg/genericclioptions"
 	"k8s.io/client-go/rest"
+	"kubegems.io/bundle-controller/pkg/metrics"
 	"kubegems.io/bundle-controller/pkg/utils"
 )
 
@@ -72,11 +76,24 @@ func (h *Apply) ApplyChart(ctx context.Context,
 		install.ReleaseName, install.Namespace = releaseName, releaseNamespace
 		install.CreateNamespace = true
 		install.ClientOnly = options.DryRun
-		return install.RunWithContext(ctx, chart, values)
+		install.Timeout = timeoutOf(ctx)
+		rls, err := install.RunWithContext(ctx, chart, values)
+		metrics.HelmOperations.WithLabelValues(metrics.HelmOperationInstall, metrics.Result(err)).Inc()
+		return rls, err
 	}
 	// check should upgrade
 	if existRelease.Info.Status == release.StatusDeployed && utils.EqualMapValues(existRelease.Config, values) {
-		log.Info("already uptodate", "values", values)
+		if !utils.IsResync(ctx) {
+			log.Info("already uptodate", "values", values)
+			metrics.HelmOperations.WithLabelValues(metrics.HelmOperationNoop, metrics.ResultSuccess).Inc()
+			return existRelease, nil
+		}
+		log.Info("already uptodate, reapplying manifests on resync", "values", values)
+		err := reapplyRelease(cfg, existRelease)
+		metrics.HelmOperations.WithLabelValues(metrics.HelmOperationNoop, metrics.Result(err)).Inc()
+		if err != nil {
+			return nil, err
+		}
 		return existRelease, nil
 	}
 	log.Info("upgrading", "old", existRelease.Config, "new", values)
@@ -84,12 +101,39 @@ func (h *Apply) ApplyChart(ctx context.Context,
 	client.Namespace = releaseNamespace
 	client.ResetValues = true
 	client.DryRun = options.DryRun
+	client.Timeout = timeoutOf(ctx)
 
 	// client.MaxHistory = 10 // there is a bug,do not use it.
 	const historiesLimit = 2
 	removeHistories(ctx, cfg.Releases, releaseName, historiesLimit)
 
-	return client.RunWithContext(ctx, releaseName, chart, values)
+	rls, err := client.RunWithContext(ctx, releaseName, chart, values)
+	metrics.HelmOperations.WithLabelValues(metrics.HelmOperationUpgrade, metrics.Result(err)).Inc()
+	return rls, err
+}
+
+// timeoutOf returns the time left before ctx deadline for helm actions waiting hooks,
+// helm's default timeout is used if ctx has no deadline.
+func timeoutOf(ctx context.Context) time.Duration {
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return defaultHelmTimeout
+}
+
+const defaultHelmTimeout = 300 * time.Second
+
+// reapplyRelease applies manifests of a deployed release again without a new revision,
+// resources removed or modified outside of helm are restored.
+func reapplyRelease(cfg *action.Configuration, rls *release.Release) error {
+	resources, err := cfg.KubeClient.Build(bytes.NewBufferString(rls.Manifest), false)
+	if err != nil {
+		return fmt.Errorf("build release manifests: %w", err)
+	}
+	if _, err := cfg.KubeClient.Update(resources, resources, false); err != nil {
+		return fmt.Errorf("reapply release manifests: %w", err)
+	}
+	return nil
 }
 
 func NewHelmConfig(ctx context.Context, namespace string, cfg *rest.Config) (*action.Configuration, error) {
@@ -116,6 +160,19 @@ func NewHelmConfig(ctx context.Context, namespace string, cfg *rest.Config) (*ac
 // if repopath is not empty,download it from repo and set chartNameOrPath to repo/repopath.
 // LoadChart loads the chart from the repository
 func LoadChart(ctx context.Context, nameOrPath, repo, version string) (string, *chart.Chart, error) {
+	type loaded struct {
+		path  string
+		chart *chart.Chart
+	}
+	// helm downloads charts without context, but writes files atomically
+	result, err := utils.RunWithContext(ctx, "chart/"+repo+"/"+nameOrPath+"/"+version, func(context.Context) (loaded, error) {
+		path, chart, err := loadChart(nameOrPath, repo, version)
+		return loaded{path: path, chart: chart}, err
+	})
+	return result.path, result.chart, err
+}
+
+func loadChart(nameOrPath, repo, version string) (string, *chart.Chart, error) {
 	chartPathOptions := action.ChartPathOptions{RepoURL: repo, Version: version}
 	settings := cli.New()
 	chartPath, err := chartPathOptions.LocateChart(nameOrPath, settings)
@@ -149,6 +206,61 @@ func LoadChart(ctx context.Context, nameOrPath, repo, version string) (string, *
 	return chartPath, chart, nil
 }
 
+// RollbackChart rolls back the release to the last deployed revision before the current one,
+// returns the revision rolled back to.
+func (h *Apply) RollbackChart(ctx context.Context, releaseName, releaseNamespace string) (int, error) {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg, err := NewHelmConfig(ctx, releaseNamespace, h.Config)
+	if err != nil {
+		return 0, err
+	}
+	histories, err := action.NewHistory(cfg).Run(releaseName)
+	if err != nil {
+		return 0, err
+	}
+	releaseutil.Reverse(histories, releaseutil.SortByRevision)
+	revision := 0
+	for i, rls := range histories {
+		if i > 0 && (rls.Info.Status == release.StatusDeployed || rls.Info.Status == release.StatusSuperseded) {
+			revision = rls.Version
+			break
+		}
+	}
+	if revision == 0 {
+		return 0, errors.New("no previous deployed revision")
+	}
+	log.Info("rolling back", "revision", revision)
+	rollback := action.NewRollback(cfg)
+	rollback.Version = revision
+	rollback.Timeout = timeoutOf(ctx)
+	err = rollback.Run(releaseName)
+	metrics.HelmOperations.WithLabelValues(metrics.HelmOperationRollback, metrics.Result(err)).Inc()
+	return revision, err
+}
+
+// RemoveReleaseRecord removes all revisions of the release from storage, the release resources are kept.
+func (h *Apply) RemoveReleaseRecord(ctx context.Context, releaseName, releaseNamespace string) error {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg, err := NewHelmConfig(ctx, releaseNamespace, h.Config)
+	if err != nil {
+		return err
+	}
+	histories, err := cfg.Releases.History(releaseName)
+	if err != nil {
+		if errors.Is(err, driver.ErrReleaseNotFound) {
+			return nil
+		}
+		return err
+	}
+	for _, rls := range histories {
+		log.Info("removing release record", "revision", rls.Version)
+		if _, err := cfg.Releases.Delete(rls.Name, rls.Version); err != nil && !errors.Is(err, driver.ErrReleaseNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
 type RemoveOptions struct {
 	DryRun bool
 }
@@ -168,7 +280,9 @@ func (h *Apply) RemoveChart(ctx context.Context, releaseName, releaseNamespace s
 	}
 	log.Info("uninstalling")
 	uninstall := action.NewUninstall(cfg)
+	uninstall.Timeout = timeoutOf(ctx)
 	uninstalledRelease, err := uninstall.Run(exist.Name)
+	metrics.HelmOperations.WithLabelValues(metrics.HelmOperationUninstall, metrics.Result(err)).Inc()
 	if err != nil {
 		return nil, err
 	}
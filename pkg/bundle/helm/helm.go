@@ -10,6 +10,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/rest"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
 	"kubegems.io/bundle-controller/pkg/utils"
 )
@@ -32,15 +33,22 @@ func (r *Apply) Template(ctx context.Context, bundle *bundlev1.Bundle, into stri
 }
 
 func (r *Apply) Apply(ctx context.Context, bundle *bundlev1.Bundle, into string) error {
+	recorder := utils.EventRecorderFromContextOrDiscard(ctx)
+	lastUpgrade := bundle.Status.UpgradeTimestamp
 	rls := r.getPreRelease(bundle)
 	applyedRelease, err := r.ApplyChart(ctx, rls.Name, rls.Namespace, into, rls.Config, ApplyOptions{})
 	if err != nil {
+		bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonApplyFailed, err.Error())
 		return err
 	}
+	bundle.SetCondition(bundlev1.ConditionRendered, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
 	bundle.Status.Resources = parseResource([]byte(applyedRelease.Manifest))
 	if applyedRelease.Info.Status != release.StatusDeployed {
-		return fmt.Errorf("apply not finished:%s", applyedRelease.Info.Description)
+		err := fmt.Errorf("apply not finished:%s", applyedRelease.Info.Description)
+		bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonNotDeployed, err.Error())
+		return err
 	}
+	bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
 	bundle.Status.Phase = bundlev1.PhaseInstalled
 	bundle.Status.Message = applyedRelease.Info.Notes
 	bundle.Status.Namespace = applyedRelease.Namespace
@@ -49,6 +57,15 @@ func (r *Apply) Apply(ctx context.Context, bundle *bundlev1.Bundle, into string)
 	bundle.Status.Values = bundlev1.Values{Object: applyedRelease.Config}
 	bundle.Status.Version = applyedRelease.Chart.Metadata.Version
 	bundle.Status.AppVersion = applyedRelease.Chart.Metadata.AppVersion
+
+	switch {
+	case lastUpgrade.IsZero():
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonInstalled, "installed release %s revision %d", applyedRelease.Name, applyedRelease.Version)
+	case !lastUpgrade.Equal(&bundle.Status.UpgradeTimestamp):
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUpgraded, "upgraded release %s to revision %d", applyedRelease.Name, applyedRelease.Version)
+	default:
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUpToDate, "release %s revision %d is up to date", applyedRelease.Name, applyedRelease.Version)
+	}
 	return nil
 }
 
@@ -72,9 +89,29 @@ func (r *Apply) Remove(ctx context.Context, bundle *bundlev1.Bundle) error {
 	}
 	bundle.Status.Phase = bundlev1.PhaseDisabled
 	bundle.Status.Message = removedRelease.Info.Description
+	utils.EventRecorderFromContextOrDiscard(ctx).Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUninstalled, "uninstalled release %s", removedRelease.Name)
 	return nil
 }
 
+// Orphan leaves the release running, the release record is removed if the bundle has AnnotationRemoveReleaseRecord.
+func (r *Apply) Orphan(ctx context.Context, bundle *bundlev1.Bundle) error {
+	if bundle.Annotations[bundlecommon.AnnotationRemoveReleaseRecord] != "true" {
+		return nil
+	}
+	rls := r.getPreRelease(bundle)
+	return r.RemoveReleaseRecord(ctx, rls.Name, rls.Namespace)
+}
+
+// Rollback rolls back the release to the last deployed revision.
+func (r *Apply) Rollback(ctx context.Context, bundle *bundlev1.Bundle) (string, error) {
+	rls := r.getPreRelease(bundle)
+	revision, err := r.RollbackChart(ctx, rls.Name, rls.Namespace)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled back release %s to revision %d", rls.Name, revision), nil
+}
+
 func (r Apply) getPreRelease(bundle *bundlev1.Bundle) *release.Release {
 	releaseNamespace := bundle.Spec.InstallNamespace
 	if releaseNamespace == "" {
@@ -4,12 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
 	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/metrics"
 	"kubegems.io/bundle-controller/pkg/utils"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
@@ -20,6 +23,9 @@ type TemplateFun func(ctx context.Context, bundle *bundlev1.Bundle, into string)
 type Apply struct {
 	TemplateFun TemplateFun
 	Cli         *utils.Apply
+	// Snapshots is the client to store snapshots, default to the client of Cli.
+	// It is the client of controller cluster when resources are applied into a remote cluster.
+	Snapshots client.Client
 }
 
 func New(cli client.Client, fun TemplateFun) *Apply {
@@ -30,20 +36,28 @@ func New(cli client.Client, fun TemplateFun) *Apply {
 }
 
 func (p *Apply) Template(ctx context.Context, bundle *bundlev1.Bundle, into string) ([]byte, error) {
-	return p.TemplateFun(ctx, bundle, into)
+	defer metrics.ObserveSince(metrics.RenderDuration.With(metrics.BundleLabels(bundle)), time.Now())
+	// rendering can't be cancelled, a kustomize build may take a long time
+	return utils.RunWithContext(ctx, "render/"+bundle.Namespace+"/"+bundle.Name, func(ctx context.Context) ([]byte, error) {
+		return p.TemplateFun(ctx, bundle, into)
+	})
 }
 
 func (p *Apply) Apply(ctx context.Context, bundle *bundlev1.Bundle, into string) error {
 	log := logr.FromContextOrDiscard(ctx)
+	recorder := utils.EventRecorderFromContextOrDiscard(ctx)
 
 	renderd, err := p.Template(ctx, bundle, into)
 	if err != nil {
+		bundle.SetCondition(bundlev1.ConditionRendered, metav1.ConditionFalse, bundlev1.ReasonRenderFailed, err.Error())
 		return err
 	}
 	resources, err := utils.SplitYAML(renderd)
 	if err != nil {
+		bundle.SetCondition(bundlev1.ConditionRendered, metav1.ConditionFalse, bundlev1.ReasonRenderFailed, err.Error())
 		return err
 	}
+	bundle.SetCondition(bundlev1.ConditionRendered, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
 
 	ns := bundle.Spec.InstallNamespace
 	if ns == "" {
@@ -53,17 +67,49 @@ func (p *Apply) Apply(ctx context.Context, bundle *bundlev1.Bundle, into string)
 	SetNamespaceIfNotSet(ns, p.Cli.Client, resources)
 
 	diffresult := utils.Diff(bundle.Status.Resources, resources)
-	if bundle.Status.Phase == bundlev1.PhaseInstalled &&
+	// a failed bundle is always applied again, failed updates are kept as managed resources
+	upToDate := !bundle.Status.UpgradeTimestamp.IsZero() &&
+		bundle.Status.Phase != bundlev1.PhaseFailed &&
 		utils.EqualMapValues(bundle.Status.Values.Object, bundle.Spec.Values.Object) &&
 		len(diffresult.Creats) == 0 &&
-		len(diffresult.Removes) == 0 {
+		len(diffresult.Removes) == 0
+	if upToDate && !utils.IsResync(ctx) {
 		log.Info("all resources are already applied")
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUpToDate, "all %d resources are up to date", len(resources))
+		// a spec change may render the same resources, e.g. interval or resuming from suspend
+		bundle.Status.Phase = bundlev1.PhaseInstalled
+		bundle.Status.Message = ""
 		return nil
 	}
+	// apply an up to date bundle on resync to correct drifts of resources
 	managedResources, err := p.Cli.SyncDiff(ctx, diffresult, utils.NewDefaultSyncOptions())
+	countOperations(bundle, diffresult)
 	if err != nil {
+		// keep track of partially applied resources, so they can be pruned or rolled back
+		bundle.Status.Resources = managedResources
+		bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonApplyFailed, err.Error())
 		return err
 	}
+	if err := p.SaveSnapshot(ctx, bundle, renderd); err != nil {
+		log.Error(err, "save snapshot")
+	}
+	bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
+	if upToDate {
+		log.Info("all resources are applied again")
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUpToDate, "all %d resources are up to date, applied again", len(resources))
+		bundle.Status.Resources = managedResources
+		bundle.Status.Phase = bundlev1.PhaseInstalled
+		bundle.Status.Message = ""
+		return nil
+	}
+	reason := utils.EventReasonUpgraded
+	if bundle.Status.CreationTimestamp.IsZero() {
+		reason = utils.EventReasonInstalled
+	}
+	recorder.Eventf(bundle, corev1.EventTypeNormal, reason, "created %d, applied %d resources", len(diffresult.Creats), len(diffresult.Applys))
+	if len(diffresult.Removes) > 0 {
+		recorder.Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonPruned, "pruned %d resources: %s", len(diffresult.Removes), utils.FormatObjects(diffresult.Removes))
+	}
 	bundle.Status.Resources = managedResources
 	bundle.Status.Values = bundlev1.Values{Object: bundle.Spec.Values.Object}.FullFill()
 	bundle.Status.Phase = bundlev1.PhaseInstalled
@@ -83,10 +129,25 @@ func (p *Apply) Remove(ctx context.Context, bundle *bundlev1.Bundle) error {
 	if err != nil {
 		return err
 	}
+	metrics.ResourceOperations.WithLabelValues(bundle.Namespace, bundle.Name, metrics.OperationDelete).Add(float64(len(bundle.Status.Resources)))
+	if removed := len(bundle.Status.Resources); removed > 0 {
+		utils.EventRecorderFromContextOrDiscard(ctx).Eventf(bundle, corev1.EventTypeNormal, utils.EventReasonUninstalled, "removed %d resources", removed)
+	}
 	bundle.Status.Resources = managedResources
 	bundle.Status.Phase = bundlev1.PhaseDisabled
 	bundle.Status.Message = ""
-	return nil
+	return p.DeleteSnapshot(ctx, bundle)
+}
+
+// Orphan leaves the applied resources in cluster and removes the snapshot only.
+func (p *Apply) Orphan(ctx context.Context, bundle *bundlev1.Bundle) error {
+	return p.DeleteSnapshot(ctx, bundle)
+}
+
+func countOperations(bundle *bundlev1.Bundle, diff utils.DiffResult) {
+	metrics.ResourceOperations.WithLabelValues(bundle.Namespace, bundle.Name, metrics.OperationCreate).Add(float64(len(diff.Creats)))
+	metrics.ResourceOperations.WithLabelValues(bundle.Namespace, bundle.Name, metrics.OperationUpdate).Add(float64(len(diff.Applys)))
+	metrics.ResourceOperations.WithLabelValues(bundle.Namespace, bundle.Name, metrics.OperationDelete).Add(float64(len(diff.Removes)))
 }
 
 func SetNamespaceIfNotSet(ns string, cli client.Client, list []*unstructured.Unstructured) {
@@ -0,0 +1,68 @@
+package native
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const manifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: foo
+  namespace: default
+data:
+  key: value
+`
+
+func TestApply_UpToDate(t *testing.T) {
+	tests := []struct {
+		name string
+		// phase is the phase before apply
+		phase     bundlev1.Phase
+		wantApply bool
+	}{
+		{name: "spec changed without changes of resources", phase: bundlev1.PhaseUpgrading},
+		{name: "resumed from suspend", phase: bundlev1.PhasePending},
+		{name: "installed", phase: bundlev1.PhaseInstalled},
+		{name: "retry of failed apply", phase: bundlev1.PhaseFailed, wantApply: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheme := runtime.NewScheme()
+			_ = clientgoscheme.AddToScheme(scheme)
+			cli := fake.NewClientBuilder().WithScheme(scheme).Build()
+			apply := New(cli, func(ctx context.Context, bundle *bundlev1.Bundle, into string) ([]byte, error) {
+				return []byte(manifests), nil
+			})
+			bundle := &bundlev1.Bundle{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo", Generation: 2},
+				Spec:       bundlev1.BundleSpec{Kind: bundlev1.BundleKindTemplate},
+				Status: bundlev1.BundleStatus{
+					Phase:             tt.phase,
+					CreationTimestamp: metav1.Now(),
+					UpgradeTimestamp:  metav1.Now(),
+					Resources:         []corev1.ObjectReference{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "foo"}},
+				},
+			}
+			if err := apply.Apply(context.Background(), bundle, ""); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if bundle.Status.Phase != bundlev1.PhaseInstalled {
+				t.Errorf("phase = %s, want %s", bundle.Status.Phase, bundlev1.PhaseInstalled)
+			}
+			err := cli.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "foo"}, &corev1.ConfigMap{})
+			if applied := err == nil; applied != tt.wantApply || (err != nil && !apierrors.IsNotFound(err)) {
+				t.Errorf("resources applied = %v (%v), want %v", applied, err, tt.wantApply)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package native
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+const (
+	SnapshotSecretType = "bundle.kubegems.io/snapshot"
+	// SnapshotKeyApplied is the key of manifests last applied.
+	SnapshotKeyApplied = "applied.gz"
+	// SnapshotKeyHealthy is the key of manifests last applied and became healthy, used to roll back.
+	SnapshotKeyHealthy = "healthy.gz"
+)
+
+var ErrNoSnapshot = errors.New("no previous healthy snapshot")
+
+// snapshotKey returns the key of secret stores the last applied manifests of bundle.
+func snapshotKey(bundle *bundlev1.Bundle) client.ObjectKey {
+	return client.ObjectKey{Namespace: bundle.Namespace, Name: bundle.Name + ".snapshot"}
+}
+
+func (p *Apply) snapshots() client.Client {
+	if p.Snapshots != nil {
+		return p.Snapshots
+	}
+	return p.Cli.Client
+}
+
+// SaveSnapshot stores the rendered manifests of a successful apply.
+func (p *Apply) SaveSnapshot(ctx context.Context, bundle *bundlev1.Bundle, manifests []byte) error {
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	if _, err := gw.Write(manifests); err != nil {
+		return err
+	}
+	if err := gw.Close(); err != nil {
+		return err
+	}
+	return p.updateSnapshot(ctx, bundle, func(data map[string][]byte) {
+		data[SnapshotKeyApplied] = buf.Bytes()
+	})
+}
+
+// CommitSnapshot marks the last applied manifests healthy, it is used to roll back a failed upgrade.
+func (p *Apply) CommitSnapshot(ctx context.Context, bundle *bundlev1.Bundle) error {
+	return p.updateSnapshot(ctx, bundle, func(data map[string][]byte) {
+		if applied, ok := data[SnapshotKeyApplied]; ok {
+			data[SnapshotKeyHealthy] = applied
+		}
+	})
+}
+
+func (p *Apply) updateSnapshot(ctx context.Context, bundle *bundlev1.Bundle, fn func(data map[string][]byte)) error {
+	key := snapshotKey(bundle)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	cli := p.snapshots()
+	_, err := controllerutil.CreateOrUpdate(ctx, cli, secret, func() error {
+		secret.Type = SnapshotSecretType
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		fn(secret.Data)
+		return controllerutil.SetOwnerReference(bundle, secret, cli.Scheme())
+	})
+	return err
+}
+
+// LoadSnapshot returns the manifests of the last healthy apply, ErrNoSnapshot if not exists.
+func (p *Apply) LoadSnapshot(ctx context.Context, bundle *bundlev1.Bundle) ([]byte, error) {
+	secret := &corev1.Secret{}
+	if err := p.snapshots().Get(ctx, snapshotKey(bundle), secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, ErrNoSnapshot
+		}
+		return nil, err
+	}
+	healthy, ok := secret.Data[SnapshotKeyHealthy]
+	if !ok {
+		return nil, ErrNoSnapshot
+	}
+	gr, err := gzip.NewReader(bytes.NewReader(healthy))
+	if err != nil {
+		return nil, fmt.Errorf("invalid snapshot: %w", err)
+	}
+	defer gr.Close()
+	return io.ReadAll(gr)
+}
+
+// DeleteSnapshot removes the snapshot of bundle.
+func (p *Apply) DeleteSnapshot(ctx context.Context, bundle *bundlev1.Bundle) error {
+	key := snapshotKey(bundle)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name}}
+	return client.IgnoreNotFound(p.snapshots().Delete(ctx, secret))
+}
+
+// Rollback re-applies the manifests of the last healthy apply, resources not in it are pruned.
+func (p *Apply) Rollback(ctx context.Context, bundle *bundlev1.Bundle) (string, error) {
+	manifests, err := p.LoadSnapshot(ctx, bundle)
+	if err != nil {
+		return "", err
+	}
+	resources, err := utils.SplitYAML(manifests)
+	if err != nil {
+		return "", err
+	}
+	SetNamespaceIfNotSet(bundle.Status.Namespace, p.Cli.Client, resources)
+	managedResources, err := p.Cli.Sync(ctx, bundle.Status.Resources, resources, utils.NewDefaultSyncOptions())
+	bundle.Status.Resources = managedResources
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("rolled back %d resources to the last healthy snapshot", len(resources)), nil
+}
@@ -0,0 +1,182 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/utils"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// OutputsName returns the name of the object outputs of bundle are exported to.
+func OutputsName(bundle *bundlev1.Bundle) string {
+	if outputs := bundle.Spec.Outputs; outputs != nil && outputs.Name != "" {
+		return outputs.Name
+	}
+	return bundle.Name + "-outputs"
+}
+
+// errOutputsPending is returned when a value of outputs is not populated yet, e.g. the status of a resource.
+var errOutputsPending = errors.New("pending")
+
+// exportOutputs evaluates outputs of the installed bundle on resources in cli and its final values,
+// and writes them into the ConfigMap or Secret in the bundle namespace.
+// The object of previous outputs is deleted once outputs are removed or renamed.
+func (b *BundleApplier) exportOutputs(ctx context.Context, cli client.Client, bundle *bundlev1.Bundle) error {
+	if err := b.deletePreviousOutputs(ctx, bundle); err != nil {
+		bundle.SetCondition(bundlev1.ConditionOutputsReady, metav1.ConditionFalse, bundlev1.ReasonOutputsFailed, err.Error())
+		return fmt.Errorf("outputs: %w", err)
+	}
+	if bundle.Spec.Outputs == nil {
+		bundle.RemoveCondition(bundlev1.ConditionOutputsReady)
+		return nil
+	}
+	data, err := evaluateOutputs(ctx, cli, bundle)
+	if errors.Is(err, errOutputsPending) {
+		// checked again on resync, as resources becoming ready
+		bundle.SetCondition(bundlev1.ConditionOutputsReady, metav1.ConditionFalse, bundlev1.ReasonOutputsPending, err.Error())
+		return nil
+	}
+	if err == nil {
+		err = b.writeOutputs(ctx, bundle, data)
+	}
+	if err != nil {
+		bundle.SetCondition(bundlev1.ConditionOutputsReady, metav1.ConditionFalse, bundlev1.ReasonOutputsFailed, err.Error())
+		return fmt.Errorf("outputs: %w", err)
+	}
+	bundle.Status.Outputs = outputsReference(bundle)
+	bundle.SetCondition(bundlev1.ConditionOutputsReady, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
+	return nil
+}
+
+// outputsReference returns the object outputs of bundle are exported to, nil if no outputs.
+func outputsReference(bundle *bundlev1.Bundle) *bundlev1.OutputsReference {
+	outputs := bundle.Spec.Outputs
+	if outputs == nil {
+		return nil
+	}
+	kind := "ConfigMap"
+	if outputs.Kind == "Secret" {
+		kind = "Secret"
+	}
+	return &bundlev1.OutputsReference{Kind: kind, Name: OutputsName(bundle)}
+}
+
+// deletePreviousOutputs deletes the object outputs were last exported to if it is not the object of current outputs.
+func (b *BundleApplier) deletePreviousOutputs(ctx context.Context, bundle *bundlev1.Bundle) error {
+	previous := bundle.Status.Outputs
+	if previous == nil || b.Client == nil {
+		return nil
+	}
+	if current := outputsReference(bundle); current != nil && *current == *previous {
+		return nil
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind(previous.Kind))
+	if err := b.Client.Get(ctx, client.ObjectKey{Namespace: bundle.Namespace, Name: previous.Name}, obj); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+	} else if owner := metav1.GetControllerOf(obj); owner != nil && owner.UID == bundle.UID {
+		if err := b.Client.Delete(ctx, obj); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+	}
+	bundle.Status.Outputs = nil
+	return nil
+}
+
+// evaluateOutputs returns the exported data of outputs, a string result is exported as is, others as json.
+func evaluateOutputs(ctx context.Context, cli client.Client, bundle *bundlev1.Bundle) (map[string][]byte, error) {
+	data := map[string][]byte{}
+	for _, output := range bundle.Spec.Outputs.Values {
+		var source interface{} = bundle.Spec.Values.Object
+		if output.Kind != "" {
+			obj, err := getOutputResource(ctx, cli, bundle, output)
+			if err != nil {
+				if apierrors.IsNotFound(err) {
+					return nil, fmt.Errorf("key %s: %w: %v", output.Key, errOutputsPending, err)
+				}
+				return nil, fmt.Errorf("key %s: %w", output.Key, err)
+			}
+			source = obj.Object
+		}
+		value, found, err := utils.FindJSONPath(source, output.JSONPath)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", output.Key, err)
+		}
+		if !found {
+			return nil, fmt.Errorf("key %s: %w: jsonpath %s not found", output.Key, errOutputsPending, output.JSONPath)
+		}
+		data[output.Key] = []byte(utils.JSONPathString(value))
+	}
+	return data, nil
+}
+
+// getOutputResource gets the resource of output, which must be one of applied resources of the bundle,
+// so outputs can't export arbitrary objects the controller can read.
+func getOutputResource(ctx context.Context, cli client.Client, bundle *bundlev1.Bundle, output bundlev1.Output) (*unstructured.Unstructured, error) {
+	gvk := schema.FromAPIVersionAndKind(output.APIVersion, output.Kind)
+	namespace := output.Namespace
+	if namespace == "" {
+		namespace = bundle.Status.Namespace
+	}
+	applied := false
+	for _, ref := range bundle.Status.Resources {
+		if ref.Namespace == "" {
+			ref.Namespace = bundle.Status.Namespace
+		}
+		if ref.GroupVersionKind().GroupKind() == gvk.GroupKind() && ref.Namespace == namespace && ref.Name == output.Name {
+			applied = true
+			break
+		}
+	}
+	if !applied {
+		return nil, fmt.Errorf("%s %s/%s is not a resource of the bundle", output.Kind, namespace, output.Name)
+	}
+	// namespace is ignored by client for cluster scoped resources
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(gvk)
+	if err := cli.Get(ctx, client.ObjectKey{Namespace: namespace, Name: output.Name}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// writeOutputs creates or updates the object of outputs owned by the bundle.
+func (b *BundleApplier) writeOutputs(ctx context.Context, bundle *bundlev1.Bundle, data map[string][]byte) error {
+	if b.Client == nil {
+		return errors.New("no client of the controller cluster")
+	}
+	meta := metav1.ObjectMeta{Namespace: bundle.Namespace, Name: OutputsName(bundle)}
+	var obj client.Object
+	var setData func()
+	if bundle.Spec.Outputs.Kind == "Secret" {
+		secret := &corev1.Secret{ObjectMeta: meta}
+		obj, setData = secret, func() { secret.Data = data }
+	} else {
+		configmap := &corev1.ConfigMap{ObjectMeta: meta}
+		obj, setData = configmap, func() {
+			configmap.Data = make(map[string]string, len(data))
+			for k, v := range data {
+				configmap.Data[k] = string(v)
+			}
+		}
+	}
+	_, err := controllerutil.CreateOrUpdate(ctx, b.Client, obj, func() error {
+		if owner := metav1.GetControllerOf(obj); obj.GetResourceVersion() != "" && (owner == nil || owner.UID != bundle.UID) {
+			return fmt.Errorf("%s/%s exists and is not owned by the bundle", obj.GetNamespace(), obj.GetName())
+		}
+		setData()
+		return controllerutil.SetControllerReference(bundle, obj, b.Client.Scheme())
+	})
+	return err
+}
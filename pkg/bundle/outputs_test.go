@@ -0,0 +1,157 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestExportOutputs(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "db", Name: "postgresql"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1", Ports: []corev1.ServicePort{{Port: 5432}}},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(service).Build()
+	b := &BundleApplier{Client: cli}
+
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "postgresql", UID: "uid"},
+		Spec: bundlev1.BundleSpec{
+			Values: bundlev1.Values{Object: map[string]interface{}{"auth": map[string]interface{}{"password": "secret"}}},
+			Outputs: &bundlev1.Outputs{Kind: "Secret", Values: []bundlev1.Output{
+				{Key: "host", APIVersion: "v1", Kind: "Service", Name: "postgresql", JSONPath: "{.spec.clusterIP}"},
+				{Key: "port", APIVersion: "v1", Kind: "Service", Name: "postgresql", JSONPath: "{.spec.ports[0].port}"},
+				{Key: "password", JSONPath: "{.auth.password}"},
+			}},
+		},
+		Status: bundlev1.BundleStatus{
+			Namespace: "db",
+			Resources: []corev1.ObjectReference{{APIVersion: "v1", Kind: "Service", Name: "postgresql"}},
+		},
+	}
+	if err := b.exportOutputs(context.Background(), cli, bundle); err != nil {
+		t.Fatalf("exportOutputs() error = %v", err)
+	}
+	secret := &corev1.Secret{}
+	if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "postgresql-outputs"}, secret); err != nil {
+		t.Fatalf("get outputs: %v", err)
+	}
+	want := map[string]string{"host": "10.0.0.1", "port": "5432", "password": "secret"}
+	for k, v := range want {
+		if got := string(secret.Data[k]); got != v {
+			t.Errorf("outputs[%s] = %q, want %q", k, got, v)
+		}
+	}
+	if owner := metav1.GetControllerOf(secret); owner == nil || owner.UID != bundle.UID {
+		t.Errorf("outputs owner = %v, want the bundle", owner)
+	}
+
+	// resources not applied by the bundle are not exported
+	bundle.Status.Resources = nil
+	if err := b.exportOutputs(context.Background(), cli, bundle); err == nil {
+		t.Errorf("exportOutputs() of a resource not applied succeeded")
+	}
+	if bundle.IsConditionTrue(bundlev1.ConditionOutputsReady) {
+		t.Errorf("OutputsReady is true after failed")
+	}
+}
+
+func TestExportOutputsPendingAndRenamed(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ingress"}}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(service).Build()
+	b := &BundleApplier{Client: cli}
+
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "ingress", UID: "uid"},
+		Spec: bundlev1.BundleSpec{
+			Outputs: &bundlev1.Outputs{Values: []bundlev1.Output{
+				{Key: "ip", APIVersion: "v1", Kind: "Service", Name: "ingress", JSONPath: "{.status.loadBalancer.ingress[0].ip}"},
+			}},
+		},
+		Status: bundlev1.BundleStatus{
+			Namespace: "default",
+			Resources: []corev1.ObjectReference{{APIVersion: "v1", Kind: "Service", Name: "ingress"}},
+		},
+	}
+	// the load balancer is not provisioned yet
+	if err := b.exportOutputs(context.Background(), cli, bundle); err != nil {
+		t.Fatalf("exportOutputs() of a pending value error = %v", err)
+	}
+	if cond := bundle.GetCondition(bundlev1.ConditionOutputsReady); cond == nil || cond.Reason != bundlev1.ReasonOutputsPending {
+		t.Errorf("OutputsReady = %v, want reason %s", cond, bundlev1.ReasonOutputsPending)
+	}
+
+	service.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "1.2.3.4"}}
+	if err := cli.Status().Update(context.Background(), service); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.exportOutputs(context.Background(), cli, bundle); err != nil {
+		t.Fatalf("exportOutputs() error = %v", err)
+	}
+	if !bundle.IsConditionTrue(bundlev1.ConditionOutputsReady) {
+		t.Errorf("OutputsReady is not true once populated")
+	}
+
+	// renamed into a secret, the previous configmap is deleted
+	bundle.Spec.Outputs.Kind, bundle.Spec.Outputs.Name = "Secret", "ingress-address"
+	if err := b.exportOutputs(context.Background(), cli, bundle); err != nil {
+		t.Fatalf("exportOutputs() error = %v", err)
+	}
+	if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "ingress-outputs"}, &corev1.ConfigMap{}); !apierrors.IsNotFound(err) {
+		t.Errorf("previous outputs not deleted, get error = %v", err)
+	}
+	if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "ingress-address"}, &corev1.Secret{}); err != nil {
+		t.Errorf("get outputs: %v", err)
+	}
+	if want := (bundlev1.OutputsReference{Kind: "Secret", Name: "ingress-address"}); bundle.Status.Outputs == nil || *bundle.Status.Outputs != want {
+		t.Errorf("status outputs = %v, want %v", bundle.Status.Outputs, want)
+	}
+
+	// outputs removed
+	bundle.Spec.Outputs = nil
+	if err := b.exportOutputs(context.Background(), cli, bundle); err != nil {
+		t.Fatalf("exportOutputs() error = %v", err)
+	}
+	if err := cli.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "ingress-address"}, &corev1.Secret{}); !apierrors.IsNotFound(err) {
+		t.Errorf("removed outputs not deleted, get error = %v", err)
+	}
+	if bundle.Status.Outputs != nil {
+		t.Errorf("status outputs = %v, want nil once removed", bundle.Status.Outputs)
+	}
+}
+
+// noReadClient fails on reads, outputs of a bundle without outputs are not looked up.
+type noReadClient struct {
+	client.Client
+}
+
+func (noReadClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	return errors.New("unexpected get")
+}
+
+func (noReadClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return errors.New("unexpected list")
+}
+
+func TestExportOutputsNone(t *testing.T) {
+	b := &BundleApplier{Client: noReadClient{}}
+	bundle := &bundlev1.Bundle{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", UID: "uid"}}
+	if err := b.exportOutputs(context.Background(), noReadClient{}, bundle); err != nil {
+		t.Errorf("exportOutputs() without outputs error = %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package bundle
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/utils"
+)
+
+// Rollbacker is implemented by appliers can roll back a bundle to its last healthy revision.
+type Rollbacker interface {
+	// Rollback rolls back the bundle and returns a description of the result.
+	Rollback(ctx context.Context, bundle *bundlev1.Bundle) (string, error)
+}
+
+// SnapshotCommitter is implemented by appliers keep snapshots of applied manifests,
+// it is called once the applied resources are healthy.
+type SnapshotCommitter interface {
+	CommitSnapshot(ctx context.Context, bundle *bundlev1.Bundle) error
+}
+
+// RetriesExhaustedError is returned when a generation with the same values failed more than the retries of remediation.
+type RetriesExhaustedError struct {
+	Failures int
+}
+
+func (e RetriesExhaustedError) Error() string {
+	return fmt.Sprintf("retries exhausted after %d failures, waiting for spec or values changes", e.Failures)
+}
+
+// checkRetries returns RetriesExhaustedError if the current generation and values failed more than retries,
+// values resolved from valuesFrom may change without a new generation.
+func checkRetries(bundle *bundlev1.Bundle) error {
+	remediation, status := bundle.Spec.Remediation, bundle.Status.Remediation
+	if remediation == nil || status == nil || status.ObservedGeneration != bundle.Generation || status.ValuesHash != valuesHash(bundle) {
+		return nil
+	}
+	if status.Failures > remediation.Retries {
+		return RetriesExhaustedError{Failures: status.Failures}
+	}
+	return nil
+}
+
+// remediate counts the failure of apply and takes the remediation strategy of bundle.
+// The bundle is kept failed, applyErr is returned with the result of remediation.
+func (b *BundleApplier) remediate(ctx context.Context, apply Apply, bundle *bundlev1.Bundle, applyErr error) error {
+	if bundle.Spec.Remediation == nil {
+		return applyErr
+	}
+	status, hash := bundle.Status.Remediation, valuesHash(bundle)
+	if status == nil || status.ObservedGeneration != bundle.Generation || status.ValuesHash != hash {
+		status = &bundlev1.RemediationStatus{ObservedGeneration: bundle.Generation, ValuesHash: hash}
+		bundle.Status.Remediation = status
+	}
+	status.Failures++
+
+	strategy := bundle.Spec.Remediation.Strategy
+	if strategy == "" || strategy == bundlev1.RemediationStrategyNone {
+		return applyErr
+	}
+	log := logr.FromContextOrDiscard(ctx).WithValues("strategy", strategy)
+	recorder := utils.EventRecorderFromContextOrDiscard(ctx)
+
+	var (
+		message string
+		err     error
+	)
+	log.Info("remediating failed apply", "failures", status.Failures)
+	switch strategy {
+	case bundlev1.RemediationStrategyRollback:
+		rollbacker, ok := apply.(Rollbacker)
+		if !ok {
+			return applyErr
+		}
+		message, err = rollbacker.Rollback(ctx, bundle)
+	case bundlev1.RemediationStrategyUninstall:
+		if err = apply.Remove(ctx, bundle); err == nil {
+			message = "uninstalled"
+		}
+	}
+	status.LastStrategy, status.LastTimestamp = strategy, metav1.Now()
+	// keep the bundle failed, remove sets it disabled
+	bundle.Status.Phase = bundlev1.PhaseFailed
+	if err != nil {
+		status.LastMessage = err.Error()
+		recorder.Eventf(bundle, corev1.EventTypeWarning, utils.EventReasonRemediationFailed, "%s failed: %v", strategy, err)
+		return fmt.Errorf("%w; %s failed: %v", applyErr, strategy, err)
+	}
+	status.LastMessage = message
+	recorder.Event(bundle, corev1.EventTypeNormal, utils.EventReasonRemediated, message)
+	return fmt.Errorf("%w; %s", applyErr, message)
+}
+
+// valuesHash returns the hash of resolved values of bundle.
+func valuesHash(bundle *bundlev1.Bundle) string {
+	// keys of maps are sorted on marshal
+	data, err := json.Marshal(bundle.Spec.Values.Object)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
@@ -0,0 +1,77 @@
+package bundle
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+)
+
+type fakeApply struct {
+	rollbacks int
+}
+
+func (f *fakeApply) Apply(ctx context.Context, bundle *bundlev1.Bundle, into string) error {
+	return nil
+}
+
+func (f *fakeApply) Remove(ctx context.Context, bundle *bundlev1.Bundle) error {
+	return nil
+}
+
+func (f *fakeApply) Template(ctx context.Context, bundle *bundlev1.Bundle, into string) ([]byte, error) {
+	return nil, nil
+}
+
+func (f *fakeApply) Rollback(ctx context.Context, bundle *bundlev1.Bundle) (string, error) {
+	f.rollbacks++
+	return "rolled back", nil
+}
+
+func TestRemediate(t *testing.T) {
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Name: "foo", Generation: 2},
+		Spec: bundlev1.BundleSpec{
+			Remediation: &bundlev1.Remediation{Strategy: bundlev1.RemediationStrategyRollback, Retries: 1},
+		},
+	}
+	apply, applyErr := &fakeApply{}, errors.New("apply failed")
+	b := &BundleApplier{}
+
+	for i := 1; i <= 2; i++ {
+		if err := checkRetries(bundle); err != nil {
+			t.Fatalf("checkRetries() on failure %d = %v, want nil", i, err)
+		}
+		if err := b.remediate(context.Background(), apply, bundle, applyErr); !errors.Is(err, applyErr) {
+			t.Fatalf("remediate() = %v, want wraps %v", err, applyErr)
+		}
+	}
+	if apply.rollbacks != 2 {
+		t.Errorf("rollbacks = %d, want 2", apply.rollbacks)
+	}
+	if status := bundle.Status.Remediation; status.Failures != 2 || status.LastStrategy != bundlev1.RemediationStrategyRollback {
+		t.Errorf("remediation status = %+v", status)
+	}
+	if err := checkRetries(bundle); !errors.As(err, &RetriesExhaustedError{}) {
+		t.Errorf("checkRetries() = %v, want RetriesExhaustedError", err)
+	}
+	// new values resolved from valuesFrom reset failures
+	bundle.Spec.Values = bundlev1.Values{Object: map[string]interface{}{"replicas": 2}}
+	if err := checkRetries(bundle); err != nil {
+		t.Errorf("checkRetries() on new values = %v, want nil", err)
+	}
+	if err := b.remediate(context.Background(), apply, bundle, applyErr); !errors.Is(err, applyErr) {
+		t.Fatalf("remediate() = %v, want wraps %v", err, applyErr)
+	}
+	if status := bundle.Status.Remediation; status.Failures != 1 {
+		t.Errorf("failures on new values = %d, want 1", status.Failures)
+	}
+	// a new generation resets failures
+	bundle.Status.Remediation.Failures = 2
+	bundle.Generation = 3
+	if err := checkRetries(bundle); err != nil {
+		t.Errorf("checkRetries() on new generation = %v, want nil", err)
+	}
+}
@@ -0,0 +1,212 @@
+package bundle
+
+import (
+	"fmt"
+	"io/fs"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/client-go/util/jsonpath"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+)
+
+// Validator validates bundles before they are accepted.
+type Validator struct {
+	Options *Options
+}
+
+// Validate returns the errors of structurally invalid or conflicting fields of bundle.
+func (v *Validator) Validate(bundle *bundlev1.Bundle) field.ErrorList {
+	spec, path := bundle.Spec, field.NewPath("spec")
+	errs := field.ErrorList{}
+
+	switch spec.Kind {
+	case bundlev1.BundleKindHelm, bundlev1.BundleKindKustomize, bundlev1.BundleKindTemplate:
+	case "":
+		errs = append(errs, field.Required(path.Child("kind"), ""))
+	default:
+		errs = append(errs, field.NotSupported(path.Child("kind"), spec.Kind,
+			[]string{string(bundlev1.BundleKindHelm), string(bundlev1.BundleKindKustomize), string(bundlev1.BundleKindTemplate)}))
+	}
+
+	if len(spec.ContentFrom) > 0 {
+		if spec.URL != "" {
+			errs = append(errs, field.Forbidden(path.Child("url"), "url and contentFrom are mutually exclusive"))
+		}
+	} else if !v.searched(bundle) {
+		// not a built-in bundle, it is downloaded into cache by url and version
+		if spec.URL == "" && spec.Kind == bundlev1.BundleKindHelm {
+			errs = append(errs, field.Required(path.Child("url"), "helm bundle not found in search paths requires url"))
+		}
+		// archives and git repositories are downloaded without version
+		if spec.Version == "" && (spec.URL == "" || IsHelmRepository(bundle)) {
+			errs = append(errs, field.Required(path.Child("version"), "bundle from a helm repository or not found in search paths requires version"))
+		}
+	}
+	for i, ref := range spec.ContentFrom {
+		errs = append(errs, validateReference(path.Child("contentFrom").Index(i), ref.Kind, ref.Name)...)
+	}
+	for i, ref := range spec.VariablesFrom {
+		errs = append(errs, validateReference(path.Child("variablesFrom").Index(i), ref.Kind, ref.Name)...)
+	}
+	for i, ref := range spec.ValuesFrom {
+		if ref.JSONPath == "" {
+			errs = append(errs, validateReference(path.Child("valuesFrom").Index(i), ref.Kind, ref.Name)...)
+		} else {
+			errs = append(errs, validateFieldReference(path.Child("valuesFrom").Index(i), ref)...)
+		}
+		if ns := ref.Namespace; ns != "" {
+			for _, msg := range validation.IsDNS1123Label(ns) {
+				errs = append(errs, field.Invalid(path.Child("valuesFrom").Index(i).Child("namespace"), ns, msg))
+			}
+		}
+		switch ref.Format {
+		case "", bundlev1.ValuesFormatYAML, bundlev1.ValuesFormatSet, bundlev1.ValuesFormatRawString:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("valuesFrom").Index(i).Child("format"), ref.Format,
+				[]string{bundlev1.ValuesFormatYAML, bundlev1.ValuesFormatSet, bundlev1.ValuesFormatRawString}))
+		}
+		// all keys would be placed at the same path
+		if ref.TargetPath != "" && ref.ValuesKey == "" && ref.JSONPath == "" {
+			errs = append(errs, field.Required(path.Child("valuesFrom").Index(i).Child("valuesKey"), "targetPath requires valuesKey"))
+		}
+	}
+
+	if ns := spec.InstallNamespace; ns != "" {
+		for _, msg := range validation.IsDNS1123Label(ns) {
+			errs = append(errs, field.Invalid(path.Child("installNamespace"), ns, msg))
+		}
+	}
+	if spec.KubeConfig != nil && spec.KubeConfig.SecretRef.Name == "" {
+		errs = append(errs, field.Required(path.Child("kubeConfig", "secretRef", "name"), ""))
+	}
+	if spec.Timeout != nil && spec.Timeout.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("timeout"), spec.Timeout.Duration.String(), "must not be negative"))
+	}
+	if spec.Interval != nil && spec.Interval.Duration < 0 {
+		errs = append(errs, field.Invalid(path.Child("interval"), spec.Interval.Duration.String(), "must not be negative"))
+	}
+	if spec.Remediation != nil && spec.Remediation.Retries < 0 {
+		errs = append(errs, field.Invalid(path.Child("remediation", "retries"), spec.Remediation.Retries, "must not be negative"))
+	}
+
+	for i, dep := range spec.Dependencies {
+		if dep.Name == "" {
+			continue
+		}
+		isBundle := dep.Kind == "" || (dep.Kind == "Bundle" && dep.APIVersion == bundlev1.GroupVersion.String())
+		if isBundle && dep.Name == bundle.Name && (dep.Namespace == "" || dep.Namespace == bundle.Namespace) {
+			errs = append(errs, field.Invalid(path.Child("dependencies").Index(i), dep.Name, "bundle can't depend on itself"))
+		}
+	}
+	for i, check := range spec.HealthChecks {
+		if _, err := jsonpath.Parse("", check.JSONPath); err != nil {
+			errs = append(errs, field.Invalid(path.Child("healthChecks").Index(i).Child("jsonPath"), check.JSONPath, err.Error()))
+		}
+	}
+	if spec.Outputs != nil {
+		errs = append(errs, validateOutputs(path.Child("outputs"), spec.Outputs)...)
+	}
+	return errs
+}
+
+// ValidateUpdate returns the errors of changes not allowed once the bundle is installed.
+func (v *Validator) ValidateUpdate(old, bundle *bundlev1.Bundle) field.ErrorList {
+	errs := v.Validate(bundle)
+	if old.Status.CreationTimestamp.IsZero() {
+		return errs
+	}
+	path := field.NewPath("spec")
+	if old.Spec.Kind != bundle.Spec.Kind {
+		errs = append(errs, field.Forbidden(path.Child("kind"), "can't be changed after installed"))
+	}
+	if old.Spec.InstallNamespace != bundle.Spec.InstallNamespace {
+		errs = append(errs, field.Forbidden(path.Child("installNamespace"), "can't be changed after installed"))
+	}
+	// the release would be left in the previous cluster or managed by another identity
+	if !reflect.DeepEqual(old.Spec.KubeConfig, bundle.Spec.KubeConfig) {
+		errs = append(errs, field.Forbidden(path.Child("kubeConfig"), "can't be changed after installed"))
+	}
+	if old.Spec.ServiceAccountName != bundle.Spec.ServiceAccountName {
+		errs = append(errs, field.Forbidden(path.Child("serviceAccountName"), "can't be changed after installed"))
+	}
+	return errs
+}
+
+// searched returns true if the bundle is found in search filesystems, without copying it into cache.
+func (v *Validator) searched(bundle *bundlev1.Bundle) bool {
+	name, version := getCacheNameVersion(bundle)
+	if version != "" {
+		name = fmt.Sprintf("%s-%s", name, version)
+	}
+	for _, fsys := range v.Options.SearchFileSystems() {
+		for _, file := range []string{name, name + ".tgz", name + ".tar.gz"} {
+			if _, err := fs.Stat(fsys, file); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func validateReference(path *field.Path, kind, name string) field.ErrorList {
+	errs := field.ErrorList{}
+	if kind != "ConfigMap" && kind != "Secret" {
+		errs = append(errs, field.NotSupported(path.Child("kind"), kind, []string{"ConfigMap", "Secret"}))
+	}
+	if name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	return errs
+}
+
+// validateFieldReference validates a valuesFrom reference to a field of any object by jsonPath.
+func validateFieldReference(path *field.Path, ref bundlev1.ValuesFrom) field.ErrorList {
+	errs := field.ErrorList{}
+	if ref.Kind == "" {
+		errs = append(errs, field.Required(path.Child("kind"), ""))
+	}
+	if ref.Name == "" {
+		errs = append(errs, field.Required(path.Child("name"), ""))
+	}
+	if _, err := jsonpath.Parse("", ref.JSONPath); err != nil {
+		errs = append(errs, field.Invalid(path.Child("jsonPath"), ref.JSONPath, err.Error()))
+	}
+	if ref.ValuesKey != "" {
+		errs = append(errs, field.Forbidden(path.Child("valuesKey"), "valuesKey and jsonPath are mutually exclusive"))
+	}
+	if ref.TargetPath == "" && ref.Format != "" && ref.Format != bundlev1.ValuesFormatYAML {
+		errs = append(errs, field.Required(path.Child("targetPath"), "jsonPath requires targetPath unless format is yaml"))
+	}
+	return errs
+}
+
+func validateOutputs(path *field.Path, outputs *bundlev1.Outputs) field.ErrorList {
+	errs := field.ErrorList{}
+	if outputs.Kind != "" && outputs.Kind != "ConfigMap" && outputs.Kind != "Secret" {
+		errs = append(errs, field.NotSupported(path.Child("kind"), outputs.Kind, []string{"ConfigMap", "Secret"}))
+	}
+	if outputs.Name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(outputs.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), outputs.Name, msg))
+		}
+	}
+	keys := map[string]bool{}
+	for i, output := range outputs.Values {
+		for _, msg := range validation.IsConfigMapKey(output.Key) {
+			errs = append(errs, field.Invalid(path.Child("values").Index(i).Child("key"), output.Key, msg))
+		}
+		if keys[output.Key] {
+			errs = append(errs, field.Duplicate(path.Child("values").Index(i).Child("key"), output.Key))
+		}
+		keys[output.Key] = true
+		if output.Kind != "" && output.Name == "" {
+			errs = append(errs, field.Required(path.Child("values").Index(i).Child("name"), "resource of kind requires name"))
+		}
+		if _, err := jsonpath.Parse("", output.JSONPath); err != nil {
+			errs = append(errs, field.Invalid(path.Child("values").Index(i).Child("jsonPath"), output.JSONPath, err.Error()))
+		}
+	}
+	return errs
+}
@@ -0,0 +1,189 @@
+package bundle
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	bundlev1api "kubegems.io/bundle-controller/pkg/apis/bundle/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/utils"
+)
+
+func TestValidator_Validate(t *testing.T) {
+	v := &Validator{Options: NewDefaultOptions()}
+	tests := []struct {
+		name    string
+		spec    bundlev1.BundleSpec
+		wantErr bool
+	}{
+		{
+			name: "valid helm",
+			spec: bundlev1.BundleSpec{Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0"},
+		},
+		{
+			name: "kustomize archive without version",
+			spec: bundlev1.BundleSpec{Kind: bundlev1.BundleKindKustomize, URL: "https://example.com/crds.tar.gz", Path: "crds"},
+		},
+		{
+			name:    "helm repository without version",
+			spec:    bundlev1.BundleSpec{Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com"},
+			wantErr: true,
+		},
+		{
+			name:    "helm without url",
+			spec:    bundlev1.BundleSpec{Kind: bundlev1.BundleKindHelm, Version: "1.0.0"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown kind",
+			spec:    bundlev1.BundleSpec{Kind: "unknown", URL: "https://charts.example.com", Version: "1.0.0"},
+			wantErr: true,
+		},
+		{
+			name: "url with contentFrom",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindKustomize, URL: "https://example.com/foo.tgz",
+				ContentFrom: []bundlev1.ContentFrom{{Kind: "ConfigMap", Name: "foo"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid valuesFrom kind",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				ValuesFrom: []bundlev1.ValuesFrom{{Kind: "Pod", Name: "foo"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "raw-string targetPath without valuesKey",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				ValuesFrom: []bundlev1.ValuesFrom{{Kind: "Secret", Name: "foo", TargetPath: "auth.password", Format: bundlev1.ValuesFormatRawString}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "yaml targetPath without valuesKey",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				ValuesFrom: []bundlev1.ValuesFrom{{Kind: "ConfigMap", Name: "foo", TargetPath: "config", Format: bundlev1.ValuesFormatYAML}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valuesFrom service field",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				ValuesFrom: []bundlev1.ValuesFrom{{Kind: "Service", Name: "foo", JSONPath: "{.spec.clusterIP}", TargetPath: "host"}},
+			},
+		},
+		{
+			name: "valuesFrom invalid jsonPath",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				ValuesFrom: []bundlev1.ValuesFrom{{Kind: "Service", Name: "foo", JSONPath: "{.spec.clusterIP", TargetPath: "host"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "duplicate output keys",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				Outputs: &bundlev1.Outputs{Values: []bundlev1.Output{
+					{Key: "host", JSONPath: "{.host}"},
+					{Key: "host", Kind: "Service", Name: "foo", JSONPath: "{.spec.clusterIP}"},
+				}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "depends on itself",
+			spec: bundlev1.BundleSpec{
+				Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0",
+				Dependencies: []corev1.ObjectReference{{Name: "foo"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := &bundlev1.Bundle{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"}, Spec: tt.spec}
+			if errs := v.Validate(bundle); (len(errs) > 0) != tt.wantErr {
+				t.Errorf("Validate() = %v, wantErr %v", errs, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_ValidateUpdate(t *testing.T) {
+	v := &Validator{Options: NewDefaultOptions()}
+	old := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "foo"},
+		Spec:       bundlev1.BundleSpec{Kind: bundlev1.BundleKindHelm, URL: "https://charts.example.com", Version: "1.0.0"},
+	}
+	bundle := old.DeepCopy()
+	bundle.Spec.Kind = bundlev1.BundleKindTemplate
+	if errs := v.ValidateUpdate(old, bundle); len(errs) > 0 {
+		t.Errorf("ValidateUpdate() before installed = %v, want no errors", errs)
+	}
+	old.Status.CreationTimestamp = metav1.Now()
+	if errs := v.ValidateUpdate(old, bundle); len(errs) == 0 {
+		t.Error("ValidateUpdate() changing kind after installed = nil, want errors")
+	}
+	bundle = old.DeepCopy()
+	bundle.Spec.KubeConfig = &bundlev1.KubeConfig{SecretRef: bundlev1.SecretKeyReference{Name: "remote"}}
+	if errs := v.ValidateUpdate(old, bundle); len(errs) == 0 {
+		t.Error("ValidateUpdate() changing kubeConfig after installed = nil, want errors")
+	}
+	bundle = old.DeepCopy()
+	bundle.Spec.ServiceAccountName = "deployer"
+	if errs := v.ValidateUpdate(old, bundle); len(errs) == 0 {
+		t.Error("ValidateUpdate() changing serviceAccountName after installed = nil, want errors")
+	}
+}
+
+func TestValidator_ValidateExamples(t *testing.T) {
+	v := &Validator{Options: NewDefaultOptions()}
+	files, err := filepath.Glob("../../examples/*.yaml")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objs, err := utils.SplitYAML(data)
+		if err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+		for _, obj := range objs {
+			if obj.GetKind() != "Bundle" {
+				continue
+			}
+			bundle := &bundlev1.Bundle{}
+			switch obj.GetAPIVersion() {
+			case bundlev1api.GroupVersion.String():
+				src := &bundlev1api.Bundle{}
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, src); err != nil {
+					t.Fatalf("%s: %v", file, err)
+				}
+				if err := src.ConvertTo(bundle); err != nil {
+					t.Fatalf("%s: %v", file, err)
+				}
+			default:
+				if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, bundle); err != nil {
+					t.Fatalf("%s: %v", file, err)
+				}
+			}
+			if errs := v.Validate(bundle); len(errs) > 0 {
+				t.Errorf("%s: Validate() bundle %s = %v, want no errors", filepath.Base(file), bundle.Name, errs)
+			}
+		}
+	}
+}
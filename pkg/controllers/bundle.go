@@ -2,42 +2,88 @@ package controllers
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"helm.sh/helm/v3/pkg/strvals"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/apimachinery/pkg/api/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
 	"kubegems.io/bundle-controller/pkg/bundle"
+	bundlemetrics "kubegems.io/bundle-controller/pkg/metrics"
+	"kubegems.io/bundle-controller/pkg/utils"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 	"sigs.k8s.io/yaml"
 )
 
 const MaxConcurrentReconciles = 5
 
+// ResyncJitterFactor is the max factor of jitter added to resync interval,
+// so bundles created at the same time are not reconciled at the same time.
+const ResyncJitterFactor = 0.1
+
+// HealthCheckInterval is the interval to check health again of a progressing bundle.
+const HealthCheckInterval = 10 * time.Second
+
 const (
 	FinalizerName = "bundle.kubegems.io/finalizer"
 )
 
 //+kubebuilder:rbac:groups=bundle.kubegems.io,resources=bundles,verbs=*
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=serviceaccounts,verbs=impersonate
+//+kubebuilder:rbac:groups="",resources=configmaps;secrets,verbs=get;list;watch;create;update
 type BundleReconciler struct {
 	client.Client
-	Applier *bundle.BundleApplier
+	// APIReader reads objects may be out of the cache, e.g. dependencies in namespaces not watched
+	// or bundles not selected, default to the client.
+	APIReader client.Reader
+	Applier   *bundle.BundleApplier
+	Recorder  *utils.EventRecorder
+	Collector *BundleCollector
+	// ResyncInterval is the default interval of bundles without .spec.interval.
+	ResyncInterval time.Duration
+	// Freeze pauses syncing of all bundles.
+	Freeze *Freeze
+	// ClusterVariables are substituted as ${cluster.<key>} in values of bundles.
+	ClusterVariables map[string]string
+	// ValuesFromKinds are kinds allowed in valuesFrom by jsonPath, empty for any kind.
+	ValuesFromKinds []schema.GroupKind
+
+	controller controller.Controller
+	watchedMu  sync.Mutex
+	watched    map[schema.GroupVersionKind]bool
+	// watchedValues are kinds of objects referenced in valuesFrom
+	watchedValues map[schema.GroupVersionKind]bool
 }
 
 func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := logr.FromContextOrDiscard(ctx)
+	ctx = utils.NewEventRecorderContext(ctx, r.Recorder)
 	app := &bundlev1.Bundle{}
 	if err := r.Client.Get(ctx, req.NamespacedName, app); err != nil {
-		if errors.IsNotFound(err) {
+		if apierrors.IsNotFound(err) {
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
@@ -52,61 +98,302 @@ func (r *BundleReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctr
 		if err := r.Update(ctx, app); err != nil {
 			return ctrl.Result{}, err
 		}
+		if app.Status.Phase == "" {
+			app.Status.Phase = bundlev1.PhasePending
+			if err := r.Status().Update(ctx, app); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
 		return ctrl.Result{Requeue: true}, nil
 	}
 
-	// check the object is being deleted then remove the finalizer
+	// check the object is being deleted then remove the finalizer once removed,
+	// a failed bundle may have installed resources before, so it is removed as well.
 	if app.DeletionTimestamp != nil && controllerutil.ContainsFinalizer(app, FinalizerName) {
-		if app.Status.Phase == bundlev1.PhaseFailed || app.Status.Phase == bundlev1.PhaseDisabled {
-			controllerutil.RemoveFinalizer(app, FinalizerName)
-			if err := r.Update(ctx, app); err != nil {
-				return ctrl.Result{}, err
-			}
-			return ctrl.Result{}, nil
+		if app.Status.Phase == bundlev1.PhaseDisabled {
+			return ctrl.Result{}, r.removeFinalizer(ctx, app)
+		}
+		if app.Annotations[bundlecommon.AnnotationSkipCleanup] == "true" {
+			log.Info("skip cleanup, resources are left in cluster")
+			r.Recorder.Eventf(app, corev1.EventTypeWarning, utils.EventReasonCleanupSkipped, "skipped cleanup of %d resources", len(app.Status.Resources))
+			return ctrl.Result{}, r.removeFinalizer(ctx, app)
 		}
 		log.Info("waiting for app to be removed, then remove finalizer")
 	}
 
-	// sync
+	// suspended bundles are kept as is, they are enqueued once resumed
+	if reason, message := r.suspendReason(ctx, app); reason != "" {
+		log.Info("suspended", "reason", reason)
+		if setSuspended(app, reason, message) {
+			return ctrl.Result{}, r.Status().Update(ctx, app)
+		}
+		return ctrl.Result{}, nil
+	}
+	if app.Status.Phase == bundlev1.PhaseSuspended {
+		app.Status.Phase = bundlev1.PhasePending
+		app.RemoveCondition(bundlev1.ConditionSuspended)
+	}
+
+	// set intermediate phase before a long running sync
+	if phase := startingPhase(app); phase != "" && phase != app.Status.Phase {
+		app.Status.Phase = phase
+		if err := r.Status().Update(ctx, app); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	// sync, resources of an up to date bundle are applied again only when a resync is due
+	resync := r.isResyncDue(app, time.Now())
+	if resync {
+		ctx = utils.NewResyncContext(ctx)
+	}
 	err := r.Sync(ctx, app)
+	if err == nil && resync {
+		app.Status.ResyncTimestamp = metav1.Now()
+	}
+	waiting := errors.As(err, &DependencyError{}) || errors.As(err, &DependentsError{})
+	// a cycle can't be resolved by retry, the bundle is enqueued once any bundle in the cycle changed,
+	// so does exhausted retries, which waits for a new generation or new values.
+	stalled := errors.As(err, &DependencyCycleError{}) || errors.As(err, &bundle.RetriesExhaustedError{})
 	if err != nil {
-		app.Status.Phase = bundlev1.PhaseFailed
 		app.Status.Message = err.Error()
+		if !waiting {
+			app.Status.Phase = bundlev1.PhaseFailed
+		}
 	}
+	app.Status.ObservedGeneration = app.Generation
+	app.SetReadyCondition(err)
+	r.recordSyncError(app, err)
 	// update status if updated whenever the sync has error or no
 	if err := r.Status().Update(ctx, app); err != nil {
 		return ctrl.Result{}, err
 	}
-	return ctrl.Result{}, err
+	// removed, the status update does not trigger a reconcile
+	if err == nil && app.DeletionTimestamp != nil && app.Status.Phase == bundlev1.PhaseDisabled {
+		return ctrl.Result{}, r.removeFinalizer(ctx, app)
+	}
+	// waiting for dependencies or dependents is not an error, the bundle is enqueued once they changed
+	if err != nil && !waiting && !stalled {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: r.resyncAfter(app)}, nil
+}
+
+func (r *BundleReconciler) removeFinalizer(ctx context.Context, bundle *bundlev1.Bundle) error {
+	controllerutil.RemoveFinalizer(bundle, FinalizerName)
+	if err := r.Update(ctx, bundle); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	bundlemetrics.DeleteBundle(bundle)
+	return nil
+}
+
+// resyncInterval returns the interval to resync the bundle, 0 if no resync.
+func (r *BundleReconciler) resyncInterval(bundle *bundlev1.Bundle) time.Duration {
+	if bundle.Spec.Disabled || bundle.DeletionTimestamp != nil {
+		return 0
+	}
+	if bundle.Spec.Interval != nil {
+		return bundle.Spec.Interval.Duration
+	}
+	return r.ResyncInterval
+}
+
+// lastResync returns the last time resources of bundle were applied, on upgrade or on resync.
+func lastResync(bundle *bundlev1.Bundle) time.Time {
+	if bundle.Status.ResyncTimestamp.Before(&bundle.Status.UpgradeTimestamp) {
+		return bundle.Status.UpgradeTimestamp.Time
+	}
+	return bundle.Status.ResyncTimestamp.Time
+}
+
+// isResyncDue returns true if the resync interval of bundle elapsed since resources were last applied.
+func (r *BundleReconciler) isResyncDue(bundle *bundlev1.Bundle, now time.Time) bool {
+	interval := r.resyncInterval(bundle)
+	return interval > 0 && now.Sub(lastResync(bundle)) >= interval
+}
+
+// resyncAfter returns the jittered duration to reconcile the bundle again, 0 if no resync.
+// It is the time left to the next resync, or shorter while resources are progressing or outputs are pending.
+func (r *BundleReconciler) resyncAfter(bundle *bundlev1.Bundle) time.Duration {
+	if bundle.Spec.Disabled || bundle.DeletionTimestamp != nil {
+		return 0
+	}
+	interval := r.resyncInterval(bundle)
+	if interval > 0 {
+		if left := interval - time.Since(lastResync(bundle)); left > 0 {
+			interval = left
+		}
+	}
+	// check again soon until resources are ready and outputs are populated
+	if (bundle.Status.Health == bundlev1.HealthStatusProgressing || isOutputsPending(bundle)) && (interval <= 0 || interval > HealthCheckInterval) {
+		interval = HealthCheckInterval
+	}
+	if interval <= 0 {
+		return 0
+	}
+	return wait.Jitter(interval, ResyncJitterFactor)
+}
+
+// isOutputsPending returns true if outputs of bundle wait for values not populated yet.
+func isOutputsPending(bundle *bundlev1.Bundle) bool {
+	cond := bundle.GetCondition(bundlev1.ConditionOutputsReady)
+	return cond != nil && cond.Reason == bundlev1.ReasonOutputsPending
+}
+
+func (r *BundleReconciler) recordSyncError(bundle *bundlev1.Bundle, err error) {
+	switch {
+	case err == nil:
+		return
+	case errors.As(err, &DependencyError{}):
+		r.Recorder.Event(bundle, corev1.EventTypeWarning, utils.EventReasonWaitingDeps, err.Error())
+	case errors.As(err, &DependentsError{}):
+		r.Recorder.Event(bundle, corev1.EventTypeWarning, utils.EventReasonRemoveBlocked, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		r.Recorder.Event(bundle, corev1.EventTypeWarning, utils.EventReasonTimeout, err.Error())
+	case bundle.Spec.Disabled || bundle.DeletionTimestamp != nil:
+		r.Recorder.Event(bundle, corev1.EventTypeWarning, utils.EventReasonRemoveFailed, err.Error())
+	default:
+		reason := utils.EventReasonSyncFailed
+		if cond := bundle.GetCondition(bundlev1.ConditionReady); cond != nil && cond.Reason != "" {
+			reason = cond.Reason
+		}
+		r.Recorder.Event(bundle, corev1.EventTypeWarning, reason, err.Error())
+	}
+}
+
+// startingPhase returns the phase to set before sync, empty if no changes.
+// Only a new generation or a removal starts a new phase, retries of a failed generation keep the phase.
+func startingPhase(bundle *bundlev1.Bundle) bundlev1.Phase {
+	if bundle.Spec.Disabled || bundle.DeletionTimestamp != nil {
+		if bundle.Status.Phase == bundlev1.PhaseDisabled {
+			return ""
+		}
+		return bundlev1.PhaseUninstalling
+	}
+	if bundle.Status.ObservedGeneration == bundle.Generation && bundle.Status.Phase != bundlev1.PhasePending {
+		return ""
+	}
+	if bundle.Status.CreationTimestamp.IsZero() {
+		return bundlev1.PhaseInstalling
+	}
+	return bundlev1.PhaseUpgrading
 }
 
-func Setup(ctx context.Context, mgr ctrl.Manager, options *bundle.Options) error {
+func Setup(ctx context.Context, mgr ctrl.Manager, options *Options, bundleoptions *bundle.Options) error {
 	cfg, cli := mgr.GetConfig(), mgr.GetClient()
+	freezeConfigMap, err := ParseConfigMapKey(options.FreezeConfigMap)
+	if err != nil {
+		return err
+	}
 	r := &BundleReconciler{
-		Client:  cli,
-		Applier: bundle.NewDefaultApply(cfg, cli, options),
+		Client:           cli,
+		APIReader:        mgr.GetAPIReader(),
+		Applier:          bundle.NewDefaultApply(cfg, cli, bundleoptions),
+		Recorder:         utils.NewEventRecorder(mgr.GetEventRecorderFor("bundle-controller")),
+		Collector:        NewBundleCollector(cli),
+		ResyncInterval:   options.ResyncInterval,
+		ClusterVariables: options.ClusterVariables,
+		ValuesFromKinds:  ParseGroupKinds(options.ValuesFromKinds),
+		Freeze: &Freeze{
+			Enabled:       options.Freeze,
+			AllowDeletion: options.FreezeAllowDeletion,
+			ConfigMap:     freezeConfigMap,
+		},
+		watched:       map[schema.GroupVersionKind]bool{},
+		watchedValues: map[schema.GroupVersionKind]bool{},
+	}
+	if err := metrics.Registry.Register(r.Collector); err != nil {
+		return err
 	}
-	handler := ConfigMapOrSecretTrigger(ctx, cli)
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&bundlev1.Bundle{}).
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &bundlev1.Bundle{}, IndexDependencies, IndexBundleDependencies); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &bundlev1.Bundle{}, IndexValuesFrom, IndexBundleValuesFrom); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &bundlev1.Bundle{}, IndexReferences, IndexBundleReferences); err != nil {
+		return err
+	}
+	b := ctrl.NewControllerManagedBy(mgr).
+		// status updates do not trigger reconcile, bundles are resynced periodically instead
+		For(&bundlev1.Bundle{}, builder.WithPredicates(predicate.Or(
+			predicate.GenerationChangedPredicate{},
+			predicate.AnnotationChangedPredicate{},
+			predicate.LabelChangedPredicate{},
+		))).
 		WithOptions(controller.Options{MaxConcurrentReconciles: MaxConcurrentReconciles}).
-		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler).
-		Watches(&source.Kind{Type: &corev1.Secret{}}, handler).
-		Complete(r)
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, ConfigMapOrSecretTrigger(ctx, cli, "ConfigMap"), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, ConfigMapOrSecretTrigger(ctx, cli, "Secret"), builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &bundlev1.Bundle{}}, DependentsTrigger(ctx, cli)).
+		Watches(&source.Kind{Type: &bundlev1.Bundle{}}, UpstreamsTrigger()).
+		Watches(&source.Kind{Type: &bundlev1.Bundle{}}, ValuesFromTrigger(ctx, cli))
+	if key := r.Freeze.ConfigMap; key.Name != "" {
+		freezeCache, err := NewFreezeCache(mgr, key)
+		if err != nil {
+			return err
+		}
+		if err := mgr.Add(freezeCache); err != nil {
+			return err
+		}
+		r.Freeze.Reader = freezeCache
+		b = b.Watches(source.NewKindWithCache(&corev1.ConfigMap{}, freezeCache), FreezeTrigger(ctx, cli, key))
+	}
+	c, err := b.Build(r)
+	if err != nil {
+		return err
+	}
+	r.controller = c
+	return nil
 }
 
 // Sync
 func (r *BundleReconciler) Sync(ctx context.Context, bundle *bundlev1.Bundle) error {
+	if bundle.DeletionTimestamp != nil && bundle.Spec.DeletionPolicy == bundlev1.DeletionPolicyOrphan {
+		// resources are kept, dependents are not affected
+		if err := r.Applier.Orphan(ctx, bundle); err != nil {
+			bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonRemoveFailed, err.Error())
+			return err
+		}
+		bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonDisabled, "bundle is removed, resources are orphaned")
+		return nil
+	}
 	if bundle.Spec.Disabled || bundle.DeletionTimestamp != nil {
+		// check no installed bundles depend on it
+		if err := r.checkDependents(ctx, bundle); err != nil {
+			bundle.SetCondition(bundlev1.ConditionRemovable, metav1.ConditionFalse, bundlev1.ReasonDependentsInstalled, err.Error())
+			return err
+		}
+		bundle.RemoveCondition(bundlev1.ConditionRemovable)
 		// just remove
-		return r.Applier.Remove(ctx, bundle)
+		if err := r.Applier.Remove(ctx, bundle); err != nil {
+			message := err.Error()
+			if bundle.DeletionTimestamp != nil {
+				message += fmt.Sprintf(", annotate %s=true to delete without cleanup", bundlecommon.AnnotationSkipCleanup)
+			}
+			bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonRemoveFailed, message)
+			return err
+		}
+		bundle.SetCondition(bundlev1.ConditionApplied, metav1.ConditionFalse, bundlev1.ReasonDisabled, "bundle is removed")
+		return nil
 	} else {
+		bundle.RemoveCondition(bundlev1.ConditionRemovable)
+		// check dependency graph of bundles
+		if err := r.checkDependencyGraph(ctx, bundle); err != nil {
+			return err
+		}
 		// check all dependencies are installed
 		if err := r.checkDepenency(ctx, bundle); err != nil {
+			bundle.SetCondition(bundlev1.ConditionDependenciesReady, metav1.ConditionFalse, bundlev1.ReasonDependencyNotReady, err.Error())
+			if errors.As(err, &DependencyError{}) {
+				bundle.Status.Phase = bundlev1.PhaseWaitingForDependencies
+			}
 			return err
 		}
+		bundle.SetCondition(bundlev1.ConditionDependenciesReady, metav1.ConditionTrue, bundlev1.ReasonSucceeded, "")
 		// resolve valuesRef
 		if err := r.resolveValuesRef(ctx, bundle); err != nil {
+			bundle.SetCondition(bundlev1.ConditionSourceReady, metav1.ConditionFalse, bundlev1.ReasonValuesResolveFailed, err.Error())
 			return err
 		}
 		return r.Applier.Apply(ctx, bundle)
@@ -127,26 +414,27 @@ func (r *BundleReconciler) checkDepenency(ctx context.Context, bundle *bundlev1.
 		if dep.Name == "" {
 			continue
 		}
-		if dep.Namespace == "" {
-			dep.Namespace = bundle.Namespace
-		}
-		if dep.Kind == "" {
-			dep.APIVersion = bundle.APIVersion
-			dep.Kind = bundle.Kind
+		dep = resolveDependency(bundle, dep)
+		// only the status of bundles is checked, other dependencies are read by metadata
+		var depobj client.Object
+		if isBundleReference(dep) {
+			depobj = &bundlev1.Bundle{}
+		} else {
+			partial := &metav1.PartialObjectMetadata{}
+			partial.SetGroupVersionKind(dep.GroupVersionKind())
+			depobj = partial
 		}
-		newobj, _ := r.Scheme().New(dep.GroupVersionKind())
-		depobj, ok := newobj.(client.Object)
-		if !ok {
-			depobj = &metav1.PartialObjectMetadata{
-				TypeMeta: metav1.TypeMeta{
-					APIVersion: dep.GroupVersionKind().GroupVersion().String(),
-					Kind:       dep.Kind,
-				},
+		// watch the dependency, so the bundle is enqueued once dependency changed
+		if err := r.watchDependency(dep.GroupVersionKind()); err != nil {
+			if meta.IsNoMatchError(err) {
+				// checked again on resync, the CRD may be installed later
+				return DependencyError{Reason: fmt.Sprintf("kind %s is not installed", dep.GroupVersionKind().GroupKind()), Object: dep}
 			}
+			return err
 		}
 
 		// exists check
-		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: dep.Namespace, Name: dep.Name}, depobj); err != nil {
+		if err := r.getDependency(ctx, client.ObjectKey{Namespace: dep.Namespace, Name: dep.Name}, depobj); err != nil {
 			if apierrors.IsNotFound(err) {
 				return DependencyError{Reason: err.Error(), Object: dep}
 			}
@@ -156,7 +444,10 @@ func (r *BundleReconciler) checkDepenency(ctx context.Context, bundle *bundlev1.
 		// status check
 		switch obj := depobj.(type) {
 		case *bundlev1.Bundle:
-			if obj.Status.Phase != bundlev1.PhaseInstalled {
+			// a suspended bundle is installed if it was ready before suspended
+			installed := obj.Status.Phase == bundlev1.PhaseInstalled ||
+				(obj.Status.Phase == bundlev1.PhaseSuspended && obj.IsConditionTrue(bundlev1.ConditionReady))
+			if !installed {
 				return DependencyError{Reason: "not installed", Object: dep}
 			}
 		}
@@ -164,59 +455,432 @@ func (r *BundleReconciler) checkDepenency(ctx context.Context, bundle *bundlev1.
 	return nil
 }
 
+// checkDependents returns a DependentsError if any installed bundle depends on the bundle.
+// If the bundle has annotation AnnotationRemoveDependents, the dependents are removed the same way first.
+func (r *BundleReconciler) checkDependents(ctx context.Context, bundle *bundlev1.Bundle) error {
+	if bundle.Annotations[bundlecommon.AnnotationForceRemove] == "true" {
+		return nil
+	}
+	bundles := &bundlev1.BundleList{}
+	key := DependencyKey(bundlev1.GroupVersion.WithKind("Bundle").GroupKind(), bundle.Namespace, bundle.Name)
+	if err := r.Client.List(ctx, bundles, client.MatchingFields{IndexDependencies: key}); err != nil {
+		return err
+	}
+	cascade := bundle.Annotations[bundlecommon.AnnotationRemoveDependents] == "true"
+	dependents := []types.NamespacedName{}
+	for i := range bundles.Items {
+		dependent := &bundles.Items[i]
+		if dependent.Status.Phase == bundlev1.PhaseDisabled {
+			continue
+		}
+		if cascade {
+			if err := r.removeDependent(ctx, bundle, dependent); err != nil {
+				return err
+			}
+		}
+		// a dependent never installed has nothing to remove before bundle
+		if dependent.Status.CreationTimestamp.IsZero() {
+			continue
+		}
+		dependents = append(dependents, client.ObjectKeyFromObject(dependent))
+	}
+	if len(dependents) == 0 {
+		return nil
+	}
+	return DependentsError{Dependents: dependents, Removing: cascade}
+}
+
+// removeDependent deletes or disables the dependent the same as bundle, and propagates AnnotationRemoveDependents.
+func (r *BundleReconciler) removeDependent(ctx context.Context, bundle, dependent *bundlev1.Bundle) error {
+	log := logr.FromContextOrDiscard(ctx)
+	if dependent.DeletionTimestamp != nil || (bundle.DeletionTimestamp == nil && dependent.Spec.Disabled) {
+		return nil // already removing
+	}
+	if dependent.Annotations == nil {
+		dependent.Annotations = map[string]string{}
+	}
+	dependent.Annotations[bundlecommon.AnnotationRemoveDependents] = "true"
+	if bundle.DeletionTimestamp == nil {
+		dependent.Spec.Disabled = true
+	}
+	if err := r.Client.Update(ctx, dependent); err != nil {
+		return err
+	}
+	if bundle.DeletionTimestamp != nil {
+		log.Info("deleting dependent", "dependent", client.ObjectKeyFromObject(dependent))
+		return client.IgnoreNotFound(r.Client.Delete(ctx, dependent))
+	}
+	log.Info("disabled dependent", "dependent", client.ObjectKeyFromObject(dependent))
+	return nil
+}
+
+// checkDependencyGraph resolves upstream bundles into status, cycles and missing upstreams are reported.
+func (r *BundleReconciler) checkDependencyGraph(ctx context.Context, bundle *bundlev1.Bundle) error {
+	if len(bundle.Spec.Dependencies) == 0 {
+		bundle.Status.Upstreams = nil
+		return nil
+	}
+	graph, err := r.dependencyGraph(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	upstreams, err := graph.Upstreams(client.ObjectKeyFromObject(bundle))
+	if err != nil {
+		switch {
+		case errors.As(err, &DependencyCycleError{}):
+			bundle.SetCondition(bundlev1.ConditionDependenciesReady, metav1.ConditionFalse, bundlev1.ReasonDependencyCycle, err.Error())
+			bundle.Status.Phase = bundlev1.PhaseFailed
+		case errors.As(err, &DependencyError{}):
+			bundle.SetCondition(bundlev1.ConditionDependenciesReady, metav1.ConditionFalse, bundlev1.ReasonDependencyMissing, err.Error())
+			bundle.Status.Phase = bundlev1.PhaseWaitingForDependencies
+		}
+		return err
+	}
+	bundle.Status.Upstreams = make([]corev1.ObjectReference, len(upstreams))
+	for i, up := range upstreams {
+		bundle.Status.Upstreams[i] = corev1.ObjectReference{
+			APIVersion: bundlev1.GroupVersion.String(),
+			Kind:       "Bundle",
+			Namespace:  up.Namespace,
+			Name:       up.Name,
+		}
+	}
+	return nil
+}
+
+// dependencyGraph returns the graph of the bundle and its upstream bundles, walked from the bundle,
+// missing upstreams are left out and reported by the graph.
+func (r *BundleReconciler) dependencyGraph(ctx context.Context, bundle *bundlev1.Bundle) (*DependencyGraph, error) {
+	bundles := []bundlev1.Bundle{*bundle}
+	seen := map[types.NamespacedName]bool{client.ObjectKeyFromObject(bundle): true}
+	for i := 0; i < len(bundles); i++ {
+		for _, dep := range bundles[i].Spec.Dependencies {
+			if dep.Name == "" {
+				continue
+			}
+			if dep = resolveDependency(&bundles[i], dep); !isBundleReference(dep) {
+				continue
+			}
+			key := types.NamespacedName{Namespace: dep.Namespace, Name: dep.Name}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			upstream := bundlev1.Bundle{}
+			if err := r.getDependency(ctx, key, &upstream); err != nil {
+				if apierrors.IsNotFound(err) {
+					continue
+				}
+				return nil, err
+			}
+			bundles = append(bundles, upstream)
+		}
+	}
+	return NewDependencyGraph(bundles), nil
+}
+
+// getDependency gets a dependency from the cache, or from the apiserver if it is out of the cache,
+// e.g. in a namespace not watched or a bundle not selected.
+func (r *BundleReconciler) getDependency(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	err := r.Client.Get(ctx, key, obj)
+	if err == nil || r.APIReader == nil {
+		return err
+	}
+	return r.APIReader.Get(ctx, key, obj)
+}
+
+// watchDependency starts watching metadata of objects of gvk if not watched.
+// A no match error is returned if the kind is unknown, the informer of an unknown kind would retry forever.
+func (r *BundleReconciler) watchDependency(gvk schema.GroupVersionKind) error {
+	if gvk.GroupKind() == bundlev1.GroupVersion.WithKind("Bundle").GroupKind() {
+		return nil // bundles are always watched
+	}
+	if _, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err != nil {
+		return err
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+	return r.watch(r.watched, gvk, obj, DependentsTrigger(context.Background(), r.Client))
+}
+
+// watchValuesFrom starts watching metadata of objects of gvk referenced in valuesFrom if not watched.
+func (r *BundleReconciler) watchValuesFrom(gvk schema.GroupVersionKind) error {
+	switch gvk.GroupKind() {
+	case corev1.SchemeGroupVersion.WithKind("ConfigMap").GroupKind(), corev1.SchemeGroupVersion.WithKind("Secret").GroupKind():
+		return nil // configmaps and secrets are always watched
+	}
+	obj := &metav1.PartialObjectMetadata{}
+	obj.SetGroupVersionKind(gvk)
+	return r.watch(r.watchedValues, gvk, obj, ValuesFromTrigger(context.Background(), r.Client))
+}
+
+func (r *BundleReconciler) watch(watched map[schema.GroupVersionKind]bool, gvk schema.GroupVersionKind, obj client.Object, handler handler.EventHandler) error {
+	if r.controller == nil {
+		return nil
+	}
+	if gvk.GroupKind() == bundlev1.GroupVersion.WithKind("Bundle").GroupKind() {
+		return nil // bundles are always watched
+	}
+	r.watchedMu.Lock()
+	defer r.watchedMu.Unlock()
+	if watched[gvk] {
+		return nil
+	}
+	if err := r.controller.Watch(&source.Kind{Type: obj.DeepCopyObject().(client.Object)}, handler); err != nil {
+		return err
+	}
+	watched[gvk] = true
+	return nil
+}
+
 func (r *BundleReconciler) resolveValuesRef(ctx context.Context, bundle *bundlev1.Bundle) error {
 	base := map[string]interface{}{}
 
 	for _, ref := range bundle.Spec.ValuesFrom {
-		switch strings.ToLower(ref.Kind) {
-		case "secret", "secrets":
-			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: bundle.Namespace}}
-			if err := r.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret); err != nil {
+		// keys of a reference with their default format
+		var groups []valuesData
+		switch kind := strings.ToLower(ref.Kind); {
+		case ref.JSONPath != "":
+			value, found, err := r.getValuesRefField(ctx, bundle, ref)
+			if err != nil {
 				if ref.Optional && apierrors.IsNotFound(err) {
 					continue
 				}
 				return err
 			}
-			// --set
-			for k, v := range secret.Data {
-				if err := mergeInto(ref.Prefix+k, string(v), base); err != nil {
-					return fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			if !found {
+				if ref.Optional {
+					continue
 				}
+				return fmt.Errorf("jsonpath %s not found in %s %s/%s", ref.JSONPath, ref.Kind, valuesRefNamespace(bundle, ref), ref.Name)
 			}
-		case "configmap", "configmaps":
-			configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: bundle.Namespace}}
-			if err := r.Client.Get(ctx, client.ObjectKeyFromObject(configmap), configmap); err != nil {
+			// a json document is also a yaml document, so the value is placed as is
+			data, err := json.Marshal(value)
+			if err != nil {
+				return err
+			}
+			if str, ok := value.(string); ok && ref.Format != "" && ref.Format != bundlev1.ValuesFormatYAML {
+				data = []byte(str)
+			}
+			groups = []valuesData{{format: bundlev1.ValuesFormatYAML, data: map[string][]byte{ref.JSONPath: data}}}
+		case kind == "secret" || kind == "secrets":
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: valuesRefNamespace(bundle, ref)}}
+			if err := r.getValuesRef(ctx, bundle, secret); err != nil {
 				if ref.Optional && apierrors.IsNotFound(err) {
 					continue
 				}
 				return err
 			}
-			// -f/--values
-			for k, v := range configmap.BinaryData {
-				currentMap := map[string]interface{}{}
-				if err := yaml.Unmarshal(v, &currentMap); err != nil {
-					return fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			// --set
+			groups = []valuesData{{format: bundlev1.ValuesFormatSet, data: secret.Data}}
+		case kind == "configmap" || kind == "configmaps":
+			configmap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ref.Name, Namespace: valuesRefNamespace(bundle, ref)}}
+			if err := r.getValuesRef(ctx, bundle, configmap); err != nil {
+				if ref.Optional && apierrors.IsNotFound(err) {
+					continue
 				}
-				base = mergeMaps(base, currentMap)
+				return err
 			}
-			// --set
+			data := make(map[string][]byte, len(configmap.Data))
 			for k, v := range configmap.Data {
-				if err := mergeInto(ref.Prefix+k, string(v), base); err != nil {
-					return fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
-				}
+				data[k] = []byte(v)
+			}
+			// -f/--values, then --set
+			groups = []valuesData{
+				{format: bundlev1.ValuesFormatYAML, data: configmap.BinaryData},
+				{format: bundlev1.ValuesFormatSet, data: data},
 			}
 		default:
 			return fmt.Errorf("valuesRef kind [%s] is not supported", ref.Kind)
 		}
+
+		if ref.ValuesKey != "" {
+			found := false
+			for i := range groups {
+				if v, ok := groups[i].data[ref.ValuesKey]; ok {
+					groups[i].data, found = map[string][]byte{ref.ValuesKey: v}, true
+				} else {
+					groups[i].data = nil
+				}
+			}
+			if !found {
+				if ref.Optional {
+					continue
+				}
+				return fmt.Errorf("key [%s] not found in %s %s/%s", ref.ValuesKey, ref.Kind, valuesRefNamespace(bundle, ref), ref.Name)
+			}
+		}
+		for _, group := range groups {
+			merged, err := mergeValuesData(base, ref, group)
+			if err != nil {
+				return err
+			}
+			base = merged
+		}
 	}
 
 	// inlined values
-	base = mergeMaps(base, bundle.Spec.Values.Object)
+	inline, err := r.substituteValues(ctx, bundle)
+	if err != nil {
+		return err
+	}
+	base = mergeMaps(base, inline)
 
 	bundle.Spec.Values = bundlev1.Values{Object: base}.FullFill()
 	return nil
 }
 
+type valuesData struct {
+	format string // used if format of the reference is empty
+	data   map[string][]byte
+}
+
+// mergeValuesData merges each key of data into base by the format and target path of ref.
+func mergeValuesData(base map[string]interface{}, ref bundlev1.ValuesFrom, values valuesData) (map[string]interface{}, error) {
+	format := ref.Format
+	if format == "" {
+		format = values.format
+	}
+	// keys are placed at the same path, the result would depend on the order of keys
+	if ref.TargetPath != "" && len(values.data) > 1 {
+		return nil, fmt.Errorf("valuesRef %s %s: targetPath requires a single key by valuesKey", ref.Kind, ref.Name)
+	}
+	keys := make([]string, 0, len(values.data))
+	for k := range values.data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		v := values.data[k]
+		path := ref.TargetPath
+		if path == "" {
+			path = ref.Prefix + k
+		}
+		switch format {
+		case bundlev1.ValuesFormatYAML:
+			if ref.TargetPath == "" {
+				currentMap := map[string]interface{}{}
+				if err := yaml.Unmarshal(v, &currentMap); err != nil {
+					return nil, fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+				}
+				base = mergeMaps(base, currentMap)
+				continue
+			}
+			var doc interface{}
+			if err := yaml.Unmarshal(v, &doc); err != nil {
+				return nil, fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			}
+			placed, err := placeValue(base, path, doc)
+			if err != nil {
+				return nil, fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			}
+			base = placed
+		case bundlev1.ValuesFormatSet:
+			if err := mergeInto(path, string(v), base); err != nil {
+				return nil, fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			}
+		case bundlev1.ValuesFormatRawString:
+			placed, err := placeValue(base, path, string(v))
+			if err != nil {
+				return nil, fmt.Errorf("parse %#v key[%s]: %w", ref, k, err)
+			}
+			base = placed
+		default:
+			return nil, fmt.Errorf("valuesRef format [%s] is not supported", format)
+		}
+	}
+	return base, nil
+}
+
+// placeValue merges value at path into base like helm --set-file, path is in the syntax of --set.
+func placeValue(base map[string]interface{}, path string, value interface{}) (map[string]interface{}, error) {
+	placed := map[string]interface{}{}
+	reader := func([]rune) (interface{}, error) { return value, nil }
+	if err := strvals.ParseIntoFile(path+"=-", placed, reader); err != nil {
+		return nil, err
+	}
+	return mergeMaps(base, placed), nil
+}
+
+// getValuesRefField evaluates the jsonpath of ref on the referenced object, found is false if the result is empty.
+func (r *BundleReconciler) getValuesRefField(ctx context.Context, bundle *bundlev1.Bundle, ref bundlev1.ValuesFrom) (interface{}, bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(valuesRefGVK(ref))
+	obj.SetNamespace(valuesRefNamespace(bundle, ref))
+	obj.SetName(ref.Name)
+	gvk := obj.GroupVersionKind()
+	if !r.isValuesFromKindAllowed(gvk.GroupKind()) {
+		return nil, false, fmt.Errorf("valuesFrom kind %s is not allowed", gvk.GroupKind())
+	}
+	if err := r.getValuesRef(ctx, bundle, obj); err != nil {
+		// an unknown kind may be installed later, it is not found as well
+		if meta.IsNoMatchError(err) {
+			return nil, false, apierrors.NewNotFound(schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}, ref.Name)
+		}
+		return nil, false, err
+	}
+	// watch the object once it is readable by the bundle, so the bundle is enqueued once it changed
+	if err := r.watchValuesFrom(gvk); err != nil {
+		return nil, false, err
+	}
+	return utils.FindJSONPath(obj.Object, ref.JSONPath)
+}
+
+// isValuesFromKindAllowed returns true if objects of kind can be referenced in valuesFrom by jsonPath.
+func (r *BundleReconciler) isValuesFromKindAllowed(kind schema.GroupKind) bool {
+	if len(r.ValuesFromKinds) == 0 {
+		return true
+	}
+	for _, allowed := range r.ValuesFromKinds {
+		if allowed == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// valuesRefNamespace returns the namespace of a values reference, default to the bundle namespace.
+func valuesRefNamespace(bundle *bundlev1.Bundle, ref bundlev1.ValuesFrom) string {
+	if ref.Namespace != "" {
+		return ref.Namespace
+	}
+	return bundle.Namespace
+}
+
+// getValuesRef gets the referenced configmap or secret, which must grant the bundle namespace if in other namespace.
+// A not granted reference is reported as not found, so bundles can't tell whether it exists.
+func (r *BundleReconciler) getValuesRef(ctx context.Context, bundle *bundlev1.Bundle, obj client.Object) error {
+	if err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return err
+	}
+	if obj.GetNamespace() == bundle.Namespace || isGranted(obj, bundle.Namespace) {
+		return nil
+	}
+	logr.FromContextOrDiscard(ctx).Info("values reference not granted", "namespace", obj.GetNamespace(), "name", obj.GetName())
+	resource := corev1.Resource("configmaps")
+	switch obj := obj.(type) {
+	case *corev1.Secret:
+		resource = corev1.Resource("secrets")
+	case *unstructured.Unstructured:
+		gvk := obj.GroupVersionKind()
+		resource = schema.GroupResource{Group: gvk.Group, Resource: strings.ToLower(gvk.Kind)}
+		if mapping, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version); err == nil {
+			resource = mapping.Resource.GroupResource()
+		}
+	}
+	return apierrors.NewNotFound(resource, obj.GetName())
+}
+
+// isGranted returns true if obj grants namespace by annotation bundle.kubegems.io/allowed-namespaces.
+func isGranted(obj client.Object, namespace string) bool {
+	for _, allowed := range strings.Split(obj.GetAnnotations()[bundlecommon.AnnotationAllowedNamespaces], ",") {
+		if allowed = strings.TrimSpace(allowed); allowed == "*" || allowed == namespace {
+			return true
+		}
+	}
+	return false
+}
+
 func mergeMaps(a, b map[string]interface{}) map[string]interface{} {
 	out := make(map[string]interface{}, len(a))
 	for k, v := range a {
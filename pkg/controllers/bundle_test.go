@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIsResyncDue(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) metav1.Time { return metav1.NewTime(now.Add(-d)) }
+	r := &BundleReconciler{ResyncInterval: 10 * time.Minute}
+	tests := []struct {
+		name   string
+		spec   bundlev1.BundleSpec
+		status bundlev1.BundleStatus
+		want   bool
+	}{
+		{
+			name:   "upgraded recently",
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Minute)},
+		},
+		{
+			name:   "upgraded before interval",
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Hour)},
+			want:   true,
+		},
+		{
+			name:   "resynced recently",
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Hour), ResyncTimestamp: ago(time.Minute)},
+		},
+		{
+			name:   "resynced before interval",
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(2 * time.Hour), ResyncTimestamp: ago(time.Hour)},
+			want:   true,
+		},
+		{
+			name:   "interval of bundle",
+			spec:   bundlev1.BundleSpec{Interval: &metav1.Duration{Duration: 30 * time.Second}},
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Minute)},
+			want:   true,
+		},
+		{
+			name:   "resync disabled",
+			spec:   bundlev1.BundleSpec{Interval: &metav1.Duration{}},
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Hour)},
+		},
+		{
+			name:   "disabled bundle",
+			spec:   bundlev1.BundleSpec{Disabled: true},
+			status: bundlev1.BundleStatus{UpgradeTimestamp: ago(time.Hour)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := &bundlev1.Bundle{Spec: tt.spec, Status: tt.status}
+			if got := r.isResyncDue(bundle, now); got != tt.want {
+				t.Errorf("isResyncDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResyncAfter(t *testing.T) {
+	r := &BundleReconciler{ResyncInterval: 10 * time.Minute}
+	bundle := &bundlev1.Bundle{Status: bundlev1.BundleStatus{UpgradeTimestamp: metav1.NewTime(time.Now().Add(-8 * time.Minute))}}
+	// requeued at the time left to the next resync, not a full interval
+	if got := r.resyncAfter(bundle); got < 2*time.Minute-time.Second || got > 3*time.Minute {
+		t.Errorf("resyncAfter() = %v, want about 2m", got)
+	}
+	bundle.Status.Health = bundlev1.HealthStatusProgressing
+	if got := r.resyncAfter(bundle); got > HealthCheckInterval*2 {
+		t.Errorf("resyncAfter() of progressing bundle = %v, want about %v", got, HealthCheckInterval)
+	}
+	bundle.Spec.Disabled = true
+	if got := r.resyncAfter(bundle); got != 0 {
+		t.Errorf("resyncAfter() of disabled bundle = %v, want 0", got)
+	}
+}
+
+func TestReconcileSkipCleanup(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	now := metav1.Now()
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         "default",
+			Name:              "foo",
+			Finalizers:        []string{FinalizerName},
+			DeletionTimestamp: &now,
+			Annotations:       map[string]string{bundlecommon.AnnotationSkipCleanup: "true"},
+		},
+		Status: bundlev1.BundleStatus{
+			Phase:     bundlev1.PhaseInstalled,
+			Resources: []corev1.ObjectReference{{APIVersion: "v1", Kind: "ConfigMap", Namespace: "default", Name: "foo"}},
+		},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(bundle).Build()
+	// no applier, resources must be left as is
+	r := &BundleReconciler{Client: cli}
+	if _, err := r.Reconcile(context.Background(), ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bundle)}); err != nil {
+		t.Fatalf("Reconcile() error = %v", err)
+	}
+	// the finalizer is removed, so the deleting bundle is gone
+	if err := cli.Get(context.Background(), client.ObjectKeyFromObject(bundle), &bundlev1.Bundle{}); !apierrors.IsNotFound(err) {
+		t.Errorf("Get() after skip cleanup error = %v, want not found", err)
+	}
+	// removing the finalizer of a removed bundle is not an error
+	if err := r.removeFinalizer(context.Background(), bundle); err != nil {
+		t.Errorf("removeFinalizer() of removed bundle error = %v", err)
+	}
+}
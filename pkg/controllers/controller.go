@@ -17,16 +17,23 @@ package controllers
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
+	bundleapiv1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
 	"kubegems.io/bundle-controller/pkg/bundle"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 )
@@ -43,13 +50,24 @@ func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 	utilruntime.Must(bundlev1.SchemeBuilder.AddToScheme(scheme))
+	utilruntime.Must(bundleapiv1.SchemeBuilder.AddToScheme(scheme))
 }
 
 type Options struct {
-	MetricsAddr          string `json:"metricsAddr,omitempty" description:"The address the metric endpoint binds to."`
-	ProbeAddr            string `json:"probeAddr,omitempty" description:"The address the probe endpoint binds to."`
-	EnableLeaderElection bool   `json:"enableLeaderElection,omitempty" description:"Enable leader election for controller manager."`
-	SearchDir            string `json:"searchDir,omitempty" description:"The directory to search for bundle manifests."`
+	MetricsAddr          string            `json:"metricsAddr,omitempty" description:"The address the metric endpoint binds to."`
+	ProbeAddr            string            `json:"probeAddr,omitempty" description:"The address the probe endpoint binds to."`
+	EnableLeaderElection bool              `json:"enableLeaderElection,omitempty" description:"Enable leader election for controller manager."`
+	SearchDir            string            `json:"searchDir,omitempty" description:"The directory to search for bundle manifests."`
+	ResyncInterval       time.Duration     `json:"resyncInterval,omitempty" description:"The default interval to reconcile bundles again, 0 to disable."`
+	Freeze               bool              `json:"freeze,omitempty" description:"Freeze all bundles, installed resources are kept."`
+	FreezeAllowDeletion  bool              `json:"freezeAllowDeletion,omitempty" description:"Allow deleting bundles be removed while frozen."`
+	FreezeConfigMap      string            `json:"freezeConfigMap,omitempty" description:"The namespace/name of configmap to freeze bundles at runtime."`
+	WatchNamespaces      []string          `json:"watchNamespaces,omitempty" description:"The namespaces to watch bundles in, empty for all namespaces."`
+	BundleSelector       string            `json:"bundleSelector,omitempty" description:"The label selector of bundles to reconcile, empty for all bundles."`
+	WebhookPort          int               `json:"webhookPort,omitempty" description:"The port the validating webhook serves on, 0 to disable."`
+	WebhookCertDir       string            `json:"webhookCertDir,omitempty" description:"The directory contains tls.crt and tls.key of the webhook server."`
+	ClusterVariables     map[string]string `json:"clusterVariables,omitempty" description:"The variables of this cluster, substituted as ${cluster.<key>} in values of bundles."`
+	ValuesFromKinds      []string          `json:"valuesFromKinds,omitempty" description:"The kinds allowed in valuesFrom by jsonPath, as kind.group, empty for any kind."`
 }
 
 func NewDefaultOptions() *Options {
@@ -58,20 +76,47 @@ func NewDefaultOptions() *Options {
 		ProbeAddr:            ":8081",
 		EnableLeaderElection: false,
 		SearchDir:            "bundles",
+		ResyncInterval:       10 * time.Minute,
 	}
 }
 
+// NewCacheFunc returns a cache restricted to watched namespaces and selected bundles.
+func NewCacheFunc(options *Options) (cache.NewCacheFunc, error) {
+	selector, err := labels.Parse(options.BundleSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bundle selector: %w", err)
+	}
+	newCache := cache.New
+	if len(options.WatchNamespaces) > 0 {
+		newCache = cache.MultiNamespacedCacheBuilder(options.WatchNamespaces)
+	}
+	return func(config *rest.Config, opts cache.Options) (cache.Cache, error) {
+		opts.SelectorsByObject = cache.SelectorsByObject{&bundlev1.Bundle{}: {Label: selector}}
+		return newCache(config, opts)
+	}, nil
+}
+
 func Run(ctx context.Context, options *Options, bundleoptions *bundle.Options) error {
 	ctrl.SetLogger(zap.New(zap.UseDevMode(false)))
 
+	newCache, err := NewCacheFunc(options)
+	if err != nil {
+		setupLog.Error(err, "invalid cache options")
+		return err
+	}
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
-		Scheme:                 scheme,
+		Scheme:   scheme,
+		NewCache: newCache,
+		// configmaps and secrets are watched by metadata only, read them from apiserver directly
+		ClientDisableCacheFor:  []client.Object{&corev1.ConfigMap{}, &corev1.Secret{}},
 		MetricsBindAddress:     options.MetricsAddr,
 		HealthProbeBindAddress: options.ProbeAddr,
 		LeaseDuration:          &leaseDuration,
 		RenewDeadline:          &renewDeadline,
 		LeaderElection:         options.EnableLeaderElection,
 		LeaderElectionID:       bundlecommon.GroupName,
+		Port:                   options.WebhookPort,
+		CertDir:                options.WebhookCertDir,
 	})
 	if err != nil {
 		setupLog.Error(err, "unable to create manager")
@@ -89,8 +134,15 @@ func Run(ctx context.Context, options *Options, bundleoptions *bundle.Options) e
 	}
 
 	// setup controllers
-	if err := Setup(ctx, mgr, bundleoptions); err != nil {
+	if err := Setup(ctx, mgr, options, bundleoptions); err != nil {
 		setupLog.Error(err, "unable to set up helm controller")
+		return err
+	}
+	if options.WebhookPort > 0 {
+		if err := SetupWebhook(mgr, bundleoptions); err != nil {
+			setupLog.Error(err, "unable to set up webhook")
+			return err
+		}
 	}
 
 	setupLog.Info("starting manager")
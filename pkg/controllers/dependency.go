@@ -0,0 +1,125 @@
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type DependencyCycleError struct {
+	Path []types.NamespacedName
+}
+
+func (e DependencyCycleError) Error() string {
+	names := make([]string, len(e.Path))
+	for i, p := range e.Path {
+		names[i] = p.String()
+	}
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(names, " -> "))
+}
+
+type DependentsError struct {
+	Dependents []types.NamespacedName
+	Removing   bool
+}
+
+func (e DependentsError) Error() string {
+	names := make([]string, len(e.Dependents))
+	for i, p := range e.Dependents {
+		names[i] = p.String()
+	}
+	if e.Removing {
+		return fmt.Sprintf("waiting for dependents to be removed: %s", strings.Join(names, ", "))
+	}
+	return fmt.Sprintf("installed bundles depend on it: %s", strings.Join(names, ", "))
+}
+
+// DependencyGraph is the graph of bundles to their bundle dependencies.
+type DependencyGraph struct {
+	bundles map[types.NamespacedName]*bundlev1.Bundle
+	edges   map[types.NamespacedName][]types.NamespacedName
+}
+
+func NewDependencyGraph(bundles []bundlev1.Bundle) *DependencyGraph {
+	g := &DependencyGraph{
+		bundles: make(map[types.NamespacedName]*bundlev1.Bundle, len(bundles)),
+		edges:   make(map[types.NamespacedName][]types.NamespacedName, len(bundles)),
+	}
+	for i := range bundles {
+		bundle := &bundles[i]
+		key := client.ObjectKeyFromObject(bundle)
+		g.bundles[key] = bundle
+		for _, dep := range bundle.Spec.Dependencies {
+			if dep.Name == "" {
+				continue
+			}
+			dep = resolveDependency(bundle, dep)
+			if !isBundleReference(dep) {
+				continue
+			}
+			g.edges[key] = append(g.edges[key], types.NamespacedName{Namespace: dep.Namespace, Name: dep.Name})
+		}
+	}
+	return g
+}
+
+// Upstreams returns all bundles the bundle depends on directly or transitively, in install order.
+// A DependencyCycleError is returned if there is a cycle in upstreams,
+// a DependencyError is returned if a upstream bundle not exists.
+func (g *DependencyGraph) Upstreams(key types.NamespacedName) ([]types.NamespacedName, error) {
+	var (
+		upstreams []types.NamespacedName
+		visited   = map[types.NamespacedName]bool{}
+		path      []types.NamespacedName
+		onpath    = map[types.NamespacedName]bool{}
+	)
+	var visit func(types.NamespacedName) error
+	visit = func(node types.NamespacedName) error {
+		if onpath[node] {
+			// cut the path from the first occurrence of node
+			for i, p := range path {
+				if p == node {
+					return DependencyCycleError{Path: append(append([]types.NamespacedName{}, path[i:]...), node)}
+				}
+			}
+		}
+		if visited[node] {
+			return nil
+		}
+		if _, ok := g.bundles[node]; !ok {
+			return DependencyError{
+				Reason: "not found",
+				Object: corev1.ObjectReference{
+					APIVersion: bundlev1.GroupVersion.String(),
+					Kind:       "Bundle",
+					Namespace:  node.Namespace,
+					Name:       node.Name,
+				},
+			}
+		}
+		path, onpath[node] = append(path, node), true
+		for _, dep := range g.edges[node] {
+			if err := visit(dep); err != nil {
+				return err
+			}
+		}
+		path, onpath[node] = path[:len(path)-1], false
+		visited[node] = true
+		if node != key {
+			upstreams = append(upstreams, node)
+		}
+		return nil
+	}
+	if err := visit(key); err != nil {
+		return nil, err
+	}
+	return upstreams, nil
+}
+
+func isBundleReference(ref corev1.ObjectReference) bool {
+	return ref.GroupVersionKind().GroupKind() == bundlev1.GroupVersion.WithKind("Bundle").GroupKind()
+}
@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+func newBundle(name string, deps ...string) bundlev1.Bundle {
+	bundle := bundlev1.Bundle{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+	for _, dep := range deps {
+		bundle.Spec.Dependencies = append(bundle.Spec.Dependencies, corev1.ObjectReference{Name: dep})
+	}
+	return bundle
+}
+
+func key(name string) types.NamespacedName {
+	return types.NamespacedName{Namespace: "default", Name: name}
+}
+
+func TestDependencyGraph_Upstreams(t *testing.T) {
+	tests := []struct {
+		name      string
+		bundles   []bundlev1.Bundle
+		bundle    string
+		want      []types.NamespacedName
+		wantCycle []types.NamespacedName
+		wantErr   error
+	}{
+		{
+			name: "transitive upstreams in install order",
+			bundles: []bundlev1.Bundle{
+				newBundle("app", "db", "cache"),
+				newBundle("db", "operator"),
+				newBundle("cache", "operator"),
+				newBundle("operator"),
+			},
+			bundle: "app",
+			want:   []types.NamespacedName{key("operator"), key("db"), key("cache")},
+		},
+		{
+			name: "cycle",
+			bundles: []bundlev1.Bundle{
+				newBundle("a", "b"),
+				newBundle("b", "c"),
+				newBundle("c", "b"),
+			},
+			bundle:    "a",
+			wantCycle: []types.NamespacedName{key("b"), key("c"), key("b")},
+		},
+		{
+			name: "missing upstream",
+			bundles: []bundlev1.Bundle{
+				newBundle("a", "b"),
+				newBundle("b", "c"),
+			},
+			bundle:  "a",
+			wantErr: DependencyError{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewDependencyGraph(tt.bundles).Upstreams(key(tt.bundle))
+			if tt.wantCycle != nil {
+				cycle := DependencyCycleError{}
+				if !errors.As(err, &cycle) {
+					t.Fatalf("Upstreams() error = %v, want cycle", err)
+				}
+				if !reflect.DeepEqual(cycle.Path, tt.wantCycle) {
+					t.Errorf("Upstreams() cycle = %v, want %v", cycle.Path, tt.wantCycle)
+				}
+				return
+			}
+			if tt.wantErr != nil {
+				if !errors.As(err, &DependencyError{}) {
+					t.Fatalf("Upstreams() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Upstreams() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Upstreams() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// getOnlyReader fails on List, the apiserver is read only for single objects out of the cache.
+type getOnlyReader struct {
+	client.Reader
+}
+
+func (getOnlyReader) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	return errors.New("unexpected list")
+}
+
+func TestCheckDependencyOutOfCache(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	upstream := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "platform", Name: "db"},
+		Status:     bundlev1.BundleStatus{Phase: bundlev1.PhaseInstalled},
+	}
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: bundlev1.BundleSpec{Dependencies: []corev1.ObjectReference{
+			{Name: "db", Namespace: "platform"},
+		}},
+	}
+	// the cache has only bundles of the watched namespace
+	r := &BundleReconciler{
+		Client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(bundle).Build(),
+		APIReader: getOnlyReader{fake.NewClientBuilder().WithScheme(scheme).WithObjects(bundle, upstream).Build()},
+	}
+	if err := r.checkDepenency(context.Background(), bundle); err != nil {
+		t.Errorf("checkDepenency() error = %v", err)
+	}
+	if err := r.checkDependencyGraph(context.Background(), bundle); err != nil {
+		t.Errorf("checkDependencyGraph() error = %v", err)
+	}
+	want := []corev1.ObjectReference{{Namespace: "platform", Name: "db"}}
+	if got := bundle.Status.Upstreams; len(got) != 1 || got[0].Namespace != want[0].Namespace || got[0].Name != want[0].Name {
+		t.Errorf("checkDependencyGraph() upstreams = %v, want %v", got, want)
+	}
+
+	r.APIReader = nil
+	if err := r.checkDepenency(context.Background(), bundle); !errors.As(err, &DependencyError{}) {
+		t.Errorf("checkDepenency() without APIReader error = %v, want DependencyError", err)
+	}
+}
+
+// fakeController records watched sources.
+type fakeController struct {
+	controller.Controller
+	watches int
+	types   []client.Object
+}
+
+func (c *fakeController) Watch(src source.Source, eventhandler handler.EventHandler, predicates ...predicate.Predicate) error {
+	c.watches++
+	if kind, ok := src.(*source.Kind); ok {
+		c.types = append(c.types, kind.Type)
+	}
+	return nil
+}
+
+func TestWatchDependency(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	configmap := corev1.SchemeGroupVersion.WithKind("ConfigMap")
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(configmap, meta.RESTScopeNamespace)
+	c := &fakeController{}
+	r := &BundleReconciler{
+		Client:     fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).Build(),
+		controller: c,
+		watched:    map[schema.GroupVersionKind]bool{},
+	}
+	for i := 0; i < 2; i++ {
+		if err := r.watchDependency(configmap); err != nil {
+			t.Fatalf("watchDependency() error = %v", err)
+		}
+	}
+	if c.watches != 1 {
+		t.Errorf("watches of configmap = %d, want 1", c.watches)
+	}
+	// dependencies are watched by metadata only
+	if _, ok := c.types[0].(*metav1.PartialObjectMetadata); !ok {
+		t.Errorf("watched type of configmap = %T, want *v1.PartialObjectMetadata", c.types[0])
+	}
+	// bundles are always watched
+	if err := r.watchDependency(bundlev1.GroupVersion.WithKind("Bundle")); err != nil || c.watches != 1 {
+		t.Errorf("watchDependency() of bundle = %v, watches = %d, want no new watch", err, c.watches)
+	}
+	unknown := schema.GroupVersionKind{Group: "example.com", Version: "v1", Kind: "Database"}
+	if err := r.watchDependency(unknown); !meta.IsNoMatchError(err) || c.watches != 1 {
+		t.Errorf("watchDependency() of unknown kind = %v, watches = %d, want no match error", err, c.watches)
+	}
+}
+
+func TestCheckDependencyUnknownKind(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: bundlev1.BundleSpec{Dependencies: []corev1.ObjectReference{
+			{APIVersion: "example.com/v1", Kind: "Database", Name: "db"},
+		}},
+	}
+	r := &BundleReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(bundle).Build()}
+	// waiting for the CRD to be installed, not failed
+	if err := r.checkDepenency(context.Background(), bundle); !errors.As(err, &DependencyError{}) {
+		t.Errorf("checkDepenency() of unknown kind error = %v, want DependencyError", err)
+	}
+}
+
+func TestCheckDependencyMetadata(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Secret"), meta.RESTScopeNamespace)
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "db-password"}}
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: bundlev1.BundleSpec{Dependencies: []corev1.ObjectReference{
+			{APIVersion: "v1", Kind: "Secret", Name: "db-password"},
+		}},
+	}
+	c := &fakeController{}
+	r := &BundleReconciler{
+		Client:     fake.NewClientBuilder().WithScheme(scheme).WithRESTMapper(mapper).WithObjects(bundle, secret).Build(),
+		controller: c,
+		watched:    map[schema.GroupVersionKind]bool{},
+	}
+	if err := r.checkDepenency(context.Background(), bundle); err != nil {
+		t.Errorf("checkDepenency() error = %v", err)
+	}
+	if len(c.types) != 1 {
+		t.Fatalf("watches = %d, want 1", len(c.types))
+	}
+	if _, ok := c.types[0].(*metav1.PartialObjectMetadata); !ok {
+		t.Errorf("watched type of secret = %T, want *v1.PartialObjectMetadata", c.types[0])
+	}
+
+	bundle.Spec.Dependencies[0].Name = "missing"
+	if err := r.checkDepenency(context.Background(), bundle); !errors.As(err, &DependencyError{}) {
+		t.Errorf("checkDepenency() of missing secret error = %v, want DependencyError", err)
+	}
+}
@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+var (
+	bundlesDesc = prometheus.NewDesc(
+		"bundle_bundles",
+		"Number of bundles by namespace, kind and phase.",
+		[]string{"namespace", "kind", "phase"}, nil,
+	)
+	sinceLastSuccessDesc = prometheus.NewDesc(
+		"bundle_seconds_since_last_successful_reconcile",
+		"Seconds since resources of the bundle were last applied successfully, grows past the resync interval once the bundle is stuck.",
+		[]string{"namespace", "name"}, nil,
+	)
+)
+
+const collectTimeout = 5 * time.Second
+
+// BundleCollector collects metrics of bundles from the informer cache on scrape.
+type BundleCollector struct {
+	Reader client.Reader
+}
+
+func NewBundleCollector(reader client.Reader) *BundleCollector {
+	return &BundleCollector{Reader: reader}
+}
+
+func (c *BundleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bundlesDesc
+	ch <- sinceLastSuccessDesc
+}
+
+func (c *BundleCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), collectTimeout)
+	defer cancel()
+
+	bundles := &bundlev1.BundleList{}
+	if err := c.Reader.List(ctx, bundles); err != nil {
+		return
+	}
+
+	type phaseKey struct{ namespace, kind, phase string }
+	counts := map[phaseKey]int{}
+	now := time.Now()
+	for _, bundle := range bundles.Items {
+		counts[phaseKey{bundle.Namespace, string(bundle.Spec.Kind), string(bundle.Status.Phase)}]++
+		if since, ok := sinceLastSuccess(&bundle, now); ok {
+			ch <- prometheus.MustNewConstMetric(sinceLastSuccessDesc, prometheus.GaugeValue, since.Seconds(), bundle.Namespace, bundle.Name)
+		}
+	}
+	for k, v := range counts {
+		ch <- prometheus.MustNewConstMetric(bundlesDesc, prometheus.GaugeValue, float64(v), k.namespace, k.kind, k.phase)
+	}
+}
+
+// sinceLastSuccess returns the duration since resources of the bundle were last applied successfully,
+// on install, upgrade or resync, or since it was created if never succeeded. False if it is never reconciled.
+func sinceLastSuccess(bundle *bundlev1.Bundle, now time.Time) (time.Duration, bool) {
+	if last := lastResync(bundle); !last.IsZero() {
+		return now.Sub(last), true
+	}
+	if bundle.GetCondition(bundlev1.ConditionReady) == nil {
+		return 0, false
+	}
+	return now.Sub(bundle.CreationTimestamp.Time), true
+}
@@ -0,0 +1,64 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+)
+
+func TestSinceLastSuccess(t *testing.T) {
+	now := time.Now()
+	ago := func(d time.Duration) metav1.Time { return metav1.NewTime(now.Add(-d)) }
+	ready := []metav1.Condition{{Type: bundlev1.ConditionReady, Status: metav1.ConditionTrue}}
+	tests := []struct {
+		name   string
+		bundle bundlev1.Bundle
+		want   time.Duration
+		wantOk bool
+	}{
+		{
+			name:   "never reconciled",
+			bundle: bundlev1.Bundle{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: ago(time.Hour)}},
+		},
+		{
+			name: "never succeeded",
+			bundle: bundlev1.Bundle{
+				ObjectMeta: metav1.ObjectMeta{CreationTimestamp: ago(time.Hour)},
+				Status: bundlev1.BundleStatus{Conditions: []metav1.Condition{
+					{Type: bundlev1.ConditionReady, Status: metav1.ConditionFalse},
+				}},
+			},
+			want:   time.Hour,
+			wantOk: true,
+		},
+		{
+			name: "ready since upgraded",
+			bundle: bundlev1.Bundle{Status: bundlev1.BundleStatus{
+				Conditions:       ready,
+				UpgradeTimestamp: ago(time.Hour),
+			}},
+			want:   time.Hour,
+			wantOk: true,
+		},
+		{
+			name: "resynced after upgraded",
+			bundle: bundlev1.Bundle{Status: bundlev1.BundleStatus{
+				Conditions:       ready,
+				UpgradeTimestamp: ago(time.Hour),
+				ResyncTimestamp:  ago(time.Minute),
+			}},
+			want:   time.Minute,
+			wantOk: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := sinceLastSuccess(&tt.bundle, now)
+			if ok != tt.wantOk || got.Round(time.Second) != tt.want {
+				t.Errorf("sinceLastSuccess() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
@@ -2,37 +2,205 @@ package controllers
 
 import (
 	"context"
+	"strings"
 
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 )
 
-func ConfigMapOrSecretTrigger(ctx context.Context, cli client.Client) handler.EventHandler {
+// ConfigMapOrSecretTrigger enqueues bundles reference the configmap or secret of kind,
+// it handles metadata only objects, so configmaps and secrets are not cached entirely.
+func ConfigMapOrSecretTrigger(ctx context.Context, cli client.Client, kind string) handler.EventHandler {
 	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
-		kind := ""
-		switch obj.(type) {
-		case *corev1.ConfigMap:
-			kind = "ConfigMap"
-		case *corev1.Secret:
-			kind = "Secret"
-		default:
+		// bundles in other namespaces may reference it in valuesFrom
+		bundles := bundlev1.BundleList{}
+		key := DependencyKey(schema.GroupKind{Kind: kind}, obj.GetNamespace(), obj.GetName())
+		_ = cli.List(ctx, &bundles, client.MatchingFields{IndexReferences: key})
+
+		requests := make([]reconcile.Request, 0, len(bundles.Items))
+		for _, bundle := range bundles.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
+		}
+		return requests
+	})
+}
+
+// IndexReferences is the field index of bundles by configmaps and secrets they reference.
+const IndexReferences = "spec.references"
+
+// IndexBundleReferences returns index keys of configmaps and secrets the bundle references in .spec.valuesFrom,
+// .spec.contentFrom, .spec.variablesFrom or .spec.kubeConfig.
+func IndexBundleReferences(obj client.Object) []string {
+	bundle, ok := obj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	add := func(kind, namespace, name string) {
+		if kind == "ConfigMap" || kind == "Secret" {
+			keys = append(keys, DependencyKey(schema.GroupKind{Kind: kind}, namespace, name))
+		}
+	}
+	for _, ref := range bundle.Spec.ValuesFrom {
+		add(ref.Kind, valuesRefNamespace(bundle, ref), ref.Name)
+	}
+	if kubeconfig := bundle.Spec.KubeConfig; kubeconfig != nil {
+		add("Secret", bundle.Namespace, kubeconfig.SecretRef.Name)
+	}
+	for _, ref := range bundle.Spec.ContentFrom {
+		add(ref.Kind, bundle.Namespace, ref.Name)
+	}
+	for _, ref := range bundle.Spec.VariablesFrom {
+		add(ref.Kind, bundle.Namespace, ref.Name)
+	}
+	return keys
+}
+
+// IndexDependencies is the field index of bundles by their dependencies.
+const IndexDependencies = "spec.dependencies"
+
+// DependencyKey returns the index key of an object in IndexDependencies.
+func DependencyKey(gk schema.GroupKind, namespace, name string) string {
+	return gk.String() + "/" + namespace + "/" + name
+}
+
+// IndexBundleDependencies returns index keys of dependencies of bundle.
+func IndexBundleDependencies(obj client.Object) []string {
+	bundle, ok := obj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	for _, dep := range bundle.Spec.Dependencies {
+		if dep.Name == "" {
+			continue
+		}
+		dep = resolveDependency(bundle, dep)
+		keys = append(keys, DependencyKey(dep.GroupVersionKind().GroupKind(), dep.Namespace, dep.Name))
+	}
+	return keys
+}
+
+// resolveDependency fills the default namespace and kind of dependency.
+func resolveDependency(bundle *bundlev1.Bundle, dep corev1.ObjectReference) corev1.ObjectReference {
+	if dep.Namespace == "" {
+		dep.Namespace = bundle.Namespace
+	}
+	if dep.Kind == "" {
+		dep.APIVersion = bundlev1.GroupVersion.String()
+		dep.Kind = "Bundle"
+	}
+	return dep
+}
+
+// DependentsTrigger enqueues bundles depend on the changed object.
+func DependentsTrigger(ctx context.Context, cli client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		gvk, err := apiutil.GVKForObject(obj, cli.Scheme())
+		if err != nil {
 			return nil
 		}
+		bundles := bundlev1.BundleList{}
+		key := DependencyKey(gvk.GroupKind(), obj.GetNamespace(), obj.GetName())
+		_ = cli.List(ctx, &bundles, client.MatchingFields{IndexDependencies: key})
 
+		requests := make([]reconcile.Request, 0, len(bundles.Items))
+		for _, bundle := range bundles.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
+		}
+		return requests
+	})
+}
+
+// IndexValuesFrom is the field index of bundles by objects referenced in valuesFrom by jsonPath.
+const IndexValuesFrom = "spec.valuesFrom"
+
+// IndexBundleValuesFrom returns index keys of objects referenced in valuesFrom of bundle by jsonPath,
+// configmaps and secrets are always watched and indexed by IndexReferences.
+func IndexBundleValuesFrom(obj client.Object) []string {
+	bundle, ok := obj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	keys := []string{}
+	for _, ref := range bundle.Spec.ValuesFrom {
+		if ref.JSONPath == "" {
+			continue
+		}
+		gk := valuesRefGVK(ref).GroupKind()
+		keys = append(keys, DependencyKey(gk, valuesRefNamespace(bundle, ref), ref.Name))
+		if ref.Namespace == "" {
+			// the scope of kind is unknown here, it may be a cluster scoped object
+			keys = append(keys, DependencyKey(gk, "", ref.Name))
+		}
+	}
+	return keys
+}
+
+// valuesRefGVK returns the group version kind of a values reference, default to api version v1.
+func valuesRefGVK(ref bundlev1.ValuesFrom) schema.GroupVersionKind {
+	apiVersion := ref.APIVersion
+	if apiVersion == "" {
+		apiVersion = "v1"
+	}
+	return schema.FromAPIVersionAndKind(apiVersion, ref.Kind)
+}
+
+// ParseGroupKinds parses kinds in form of kind.group, e.g. Deployment.apps, a kind without group is of the core group.
+func ParseGroupKinds(kinds []string) []schema.GroupKind {
+	var out []schema.GroupKind
+	for _, kind := range kinds {
+		if kind = strings.TrimSpace(kind); kind != "" {
+			out = append(out, schema.ParseGroupKind(kind))
+		}
+	}
+	return out
+}
+
+// ValuesFromTrigger enqueues bundles reference the changed object in valuesFrom by jsonPath.
+func ValuesFromTrigger(ctx context.Context, cli client.Client) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		gvk, err := apiutil.GVKForObject(obj, cli.Scheme())
+		if err != nil {
+			return nil
+		}
 		bundles := bundlev1.BundleList{}
-		_ = cli.List(ctx, &bundles, client.InNamespace(obj.GetNamespace()))
+		key := DependencyKey(gvk.GroupKind(), obj.GetNamespace(), obj.GetName())
+		_ = cli.List(ctx, &bundles, client.MatchingFields{IndexValuesFrom: key})
 
-		var requests []reconcile.Request
+		requests := make([]reconcile.Request, 0, len(bundles.Items))
 		for _, bundle := range bundles.Items {
-			for _, ref := range bundle.Spec.ValuesFrom {
-				if ref.Kind == kind && ref.Name == obj.GetName() {
-					requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
-				}
-			}
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
 		}
 		return requests
 	})
 }
+
+// UpstreamsTrigger enqueues bundles the changed bundle depends on,
+// so a bundle waiting for its dependents to be removed is reconciled.
+func UpstreamsTrigger() handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(upstreamRequests)
+}
+
+// upstreamRequests returns requests of bundles the bundle depends on, only if the bundle is being removed.
+func upstreamRequests(obj client.Object) []reconcile.Request {
+	bundle, ok := obj.(*bundlev1.Bundle)
+	if !ok || (bundle.DeletionTimestamp == nil && !bundle.Spec.Disabled) {
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, dep := range bundle.Spec.Dependencies {
+		if dep.Name == "" {
+			continue
+		}
+		if dep = resolveDependency(bundle, dep); isBundleReference(dep) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: dep.Namespace, Name: dep.Name}})
+		}
+	}
+	return requests
+}
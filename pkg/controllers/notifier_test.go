@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+func TestIndexBundleReferences(t *testing.T) {
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "tenant", Name: "foo"},
+		Spec: bundlev1.BundleSpec{
+			ValuesFrom: []bundlev1.ValuesFrom{
+				{Kind: "ConfigMap", Name: "local"},
+				{Kind: "ConfigMap", Name: "global", Namespace: "platform"},
+			},
+			ContentFrom: []bundlev1.ContentFrom{{Kind: "Secret", Name: "content"}},
+		},
+	}
+	tests := []struct {
+		kind, namespace, name string
+		want                  bool
+	}{
+		{kind: "ConfigMap", namespace: "tenant", name: "local", want: true},
+		{kind: "ConfigMap", namespace: "platform", name: "local", want: false},
+		{kind: "ConfigMap", namespace: "platform", name: "global", want: true},
+		{kind: "ConfigMap", namespace: "tenant", name: "global", want: false},
+		{kind: "Secret", namespace: "tenant", name: "content", want: true},
+		{kind: "Secret", namespace: "platform", name: "content", want: false},
+	}
+	keys := IndexBundleReferences(bundle)
+	for _, tt := range tests {
+		key := DependencyKey(schema.GroupKind{Kind: tt.kind}, tt.namespace, tt.name)
+		got := false
+		for _, k := range keys {
+			got = got || k == key
+		}
+		if got != tt.want {
+			t.Errorf("IndexBundleReferences() has %s = %v, want %v", key, got, tt.want)
+		}
+	}
+}
+
+func TestIsGranted(t *testing.T) {
+	tests := []struct {
+		allowed string
+		want    bool
+	}{
+		{allowed: "", want: false},
+		{allowed: "other", want: false},
+		{allowed: "other, tenant", want: true},
+		{allowed: "*", want: true},
+	}
+	for _, tt := range tests {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{
+			Namespace:   "platform",
+			Name:        "global",
+			Annotations: map[string]string{bundlecommon.AnnotationAllowedNamespaces: tt.allowed},
+		}}
+		if got := isGranted(cm, "tenant"); got != tt.want {
+			t.Errorf("isGranted(%q) = %v, want %v", tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestUpstreamRequests(t *testing.T) {
+	now := metav1.Now()
+	dependencies := []corev1.ObjectReference{
+		{Name: "redis"},
+		{Name: "mysql", Namespace: "db"},
+		{Kind: "Deployment", APIVersion: "apps/v1", Name: "nginx"},
+	}
+	upstreams := []reconcile.Request{
+		{NamespacedName: types.NamespacedName{Namespace: "default", Name: "redis"}},
+		{NamespacedName: types.NamespacedName{Namespace: "db", Name: "mysql"}},
+	}
+	tests := []struct {
+		name     string
+		disabled bool
+		deleting *metav1.Time
+		want     []reconcile.Request
+	}{
+		{name: "installed", want: nil},
+		{name: "disabled", disabled: true, want: upstreams},
+		{name: "deleting", deleting: &now, want: upstreams},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := &bundlev1.Bundle{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app", DeletionTimestamp: tt.deleting},
+				Spec:       bundlev1.BundleSpec{Disabled: tt.disabled, Dependencies: dependencies},
+			}
+			if got := upstreamRequests(bundle); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("upstreamRequests() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/types"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+const (
+	// FreezeKey is the key in freeze configmap, set to "true" to freeze all bundles.
+	FreezeKey = "freeze"
+	// FreezeAllowDeletionKey is the key in freeze configmap, set to "true" to remove deleting bundles while frozen.
+	FreezeAllowDeletionKey = "allowDeletion"
+)
+
+// Freeze pauses syncing of all bundles, installed resources are kept.
+type Freeze struct {
+	// Enabled freezes all bundles regardless of the configmap.
+	Enabled bool
+	// AllowDeletion lets deleting bundles be removed while frozen.
+	AllowDeletion bool
+	// ConfigMap is the configmap to freeze bundles at runtime, empty to disable.
+	ConfigMap types.NamespacedName
+	// Reader reads the configmap, it is the cache created by NewFreezeCache,
+	// configmaps are not cached by the client of the manager.
+	Reader client.Reader
+}
+
+// ParseConfigMapKey parses a "namespace/name" configmap key, empty returns an empty key.
+// The namespace is required, the namespace of the controller is unknown here.
+func ParseConfigMapKey(key string) (types.NamespacedName, error) {
+	if key == "" {
+		return types.NamespacedName{}, nil
+	}
+	ns, name, ok := strings.Cut(key, "/")
+	if !ok || ns == "" || name == "" {
+		return types.NamespacedName{}, fmt.Errorf("invalid configmap %q, must be in form of namespace/name", key)
+	}
+	return types.NamespacedName{Namespace: ns, Name: name}, nil
+}
+
+// NewFreezeCache returns a cache of the freeze configmap only,
+// so it is watched even if its namespace is not in the watched namespaces of the manager.
+func NewFreezeCache(mgr ctrl.Manager, key types.NamespacedName) (cache.Cache, error) {
+	return cache.New(mgr.GetConfig(), cache.Options{
+		Scheme:    mgr.GetScheme(),
+		Mapper:    mgr.GetRESTMapper(),
+		Namespace: key.Namespace,
+		SelectorsByObject: cache.SelectorsByObject{
+			&corev1.ConfigMap{}: {Field: fields.OneTermEqualSelector("metadata.name", key.Name)},
+		},
+	})
+}
+
+// IsFrozen returns whether bundles are frozen now and whether deletion is allowed.
+func (f *Freeze) IsFrozen(ctx context.Context) (bool, bool) {
+	frozen, allowDeletion := f.Enabled, f.AllowDeletion
+	if f.ConfigMap.Name == "" || f.Reader == nil {
+		return frozen, allowDeletion
+	}
+	cm := &corev1.ConfigMap{}
+	if err := f.Reader.Get(ctx, f.ConfigMap, cm); err != nil {
+		if !apierrors.IsNotFound(err) {
+			logr.FromContextOrDiscard(ctx).Error(err, "get freeze configmap")
+		}
+		return frozen, allowDeletion
+	}
+	return frozen || cm.Data[FreezeKey] == "true", allowDeletion || cm.Data[FreezeAllowDeletionKey] == "true"
+}
+
+// suspendReason returns the reason and message if the bundle should not be synced, empty if not suspended.
+// Deleting a suspended bundle is always allowed, deleting while frozen is allowed only if the freeze allows.
+func (r *BundleReconciler) suspendReason(ctx context.Context, bundle *bundlev1.Bundle) (string, string) {
+	deleting := bundle.DeletionTimestamp != nil
+	if frozen, allowDeletion := r.Freeze.IsFrozen(ctx); frozen && !(deleting && allowDeletion) {
+		return bundlev1.ReasonFrozen, "controller is frozen"
+	}
+	if bundle.Spec.Suspend && !deleting {
+		return bundlev1.ReasonSuspended, "bundle is suspended"
+	}
+	return "", ""
+}
+
+// setSuspended sets the bundle suspended, returns true if status changed.
+func setSuspended(bundle *bundlev1.Bundle, reason, message string) bool {
+	cond := bundle.GetCondition(bundlev1.ConditionSuspended)
+	if bundle.Status.Phase == bundlev1.PhaseSuspended && cond != nil && cond.Reason == reason {
+		return false
+	}
+	bundle.Status.Phase = bundlev1.PhaseSuspended
+	bundle.SetCondition(bundlev1.ConditionSuspended, metav1.ConditionTrue, reason, message)
+	return true
+}
+
+// FreezeTrigger enqueues all bundles once the freeze configmap changed, so they are resumed.
+func FreezeTrigger(ctx context.Context, cli client.Client, key types.NamespacedName) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		if key.Name == "" || client.ObjectKeyFromObject(obj) != key {
+			return nil
+		}
+		bundles := bundlev1.BundleList{}
+		_ = cli.List(ctx, &bundles)
+		requests := make([]reconcile.Request, 0, len(bundles.Items))
+		for _, bundle := range bundles.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&bundle)})
+		}
+		return requests
+	})
+}
@@ -0,0 +1,68 @@
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseConfigMapKey(t *testing.T) {
+	tests := []struct {
+		key     string
+		want    types.NamespacedName
+		wantErr bool
+	}{
+		{key: ""},
+		{key: "kube-system/freeze", want: types.NamespacedName{Namespace: "kube-system", Name: "freeze"}},
+		{key: "freeze", wantErr: true},
+		{key: "/freeze", wantErr: true},
+		{key: "kube-system/", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			got, err := ParseConfigMapKey(tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseConfigMapKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseConfigMapKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFreezeIsFrozen(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	key := types.NamespacedName{Namespace: "kube-system", Name: "freeze"}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name},
+		Data:       map[string]string{FreezeKey: "true"},
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cm).Build()
+	tests := []struct {
+		name                        string
+		freeze                      Freeze
+		wantFrozen, wantAllowDelete bool
+	}{
+		{name: "not frozen"},
+		{name: "frozen by flag", freeze: Freeze{Enabled: true, AllowDeletion: true}, wantFrozen: true, wantAllowDelete: true},
+		{name: "frozen by configmap", freeze: Freeze{ConfigMap: key}, wantFrozen: true},
+		{name: "configmap not found", freeze: Freeze{ConfigMap: types.NamespacedName{Namespace: "default", Name: "freeze"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.freeze.Reader = cli
+			frozen, allowDeletion := tt.freeze.IsFrozen(context.Background())
+			if frozen != tt.wantFrozen || allowDeletion != tt.wantAllowDelete {
+				t.Errorf("IsFrozen() = %v, %v, want %v, %v", frozen, allowDeletion, tt.wantFrozen, tt.wantAllowDelete)
+			}
+		})
+	}
+}
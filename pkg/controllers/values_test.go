@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestMergeValuesData(t *testing.T) {
+	tests := []struct {
+		name   string
+		ref    bundlev1.ValuesFrom
+		values valuesData
+		want   map[string]interface{}
+	}{
+		{
+			name:   "default set",
+			ref:    bundlev1.ValuesFrom{Prefix: "auth."},
+			values: valuesData{format: bundlev1.ValuesFormatSet, data: map[string][]byte{"replicas": []byte("2")}},
+			want:   map[string]interface{}{"auth": map[string]interface{}{"replicas": int64(2)}},
+		},
+		{
+			name:   "raw-string at target path",
+			ref:    bundlev1.ValuesFrom{TargetPath: "auth.password", Format: bundlev1.ValuesFormatRawString},
+			values: valuesData{format: bundlev1.ValuesFormatSet, data: map[string][]byte{"password": []byte("a,b=c")}},
+			want:   map[string]interface{}{"auth": map[string]interface{}{"password": "a,b=c"}},
+		},
+		{
+			name:   "yaml of a data key",
+			ref:    bundlev1.ValuesFrom{Format: bundlev1.ValuesFormatYAML},
+			values: valuesData{format: bundlev1.ValuesFormatSet, data: map[string][]byte{"values.yaml": []byte("image:\n  tag: v1\n")}},
+			want:   map[string]interface{}{"image": map[string]interface{}{"tag": "v1"}},
+		},
+		{
+			name:   "yaml at target path",
+			ref:    bundlev1.ValuesFrom{TargetPath: "config.rules", Format: bundlev1.ValuesFormatYAML},
+			values: valuesData{format: bundlev1.ValuesFormatYAML, data: map[string][]byte{"rules.yaml": []byte("- a\n- b\n")}},
+			want:   map[string]interface{}{"config": map[string]interface{}{"rules": []interface{}{"a", "b"}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeValuesData(map[string]interface{}{}, tt.ref, tt.values)
+			if err != nil {
+				t.Fatalf("mergeValuesData() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeValuesData() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeValuesDataTargetPathKeys(t *testing.T) {
+	ref := bundlev1.ValuesFrom{TargetPath: "config", Format: bundlev1.ValuesFormatYAML}
+	values := valuesData{data: map[string][]byte{"a.yaml": []byte("a: 1\n"), "b.yaml": []byte("b: 2\n")}}
+	if _, err := mergeValuesData(map[string]interface{}{}, ref, values); err == nil {
+		t.Error("mergeValuesData() of keys at the same targetPath = nil, want error")
+	}
+}
+
+func TestResolveValuesRef_JSONPath(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = bundlev1.AddToScheme(scheme)
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "redis"},
+		Spec:       corev1.ServiceSpec{ClusterIP: "10.0.0.1"},
+	}
+	upstream := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "redis"},
+		Status:     bundlev1.BundleStatus{Values: bundlev1.Values{Object: map[string]interface{}{"auth": map[string]interface{}{"enabled": true}}}},
+	}
+	r := &BundleReconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(service, upstream).Build()}
+
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: bundlev1.BundleSpec{
+			ValuesFrom: []bundlev1.ValuesFrom{
+				{Kind: "Service", Name: "redis", JSONPath: "{.spec.clusterIP}", TargetPath: "redis.host"},
+				{APIVersion: bundlev1.GroupVersion.String(), Kind: "Bundle", Name: "redis", JSONPath: "{.status.values.auth}", TargetPath: "redis.auth"},
+				{Kind: "Service", Name: "missing", JSONPath: "{.spec.clusterIP}", TargetPath: "missing", Optional: true},
+				{APIVersion: "example.com/v1", Kind: "Unknown", Name: "redis", JSONPath: "{.spec}", TargetPath: "unknown", Optional: true},
+			},
+		},
+	}
+	if err := r.resolveValuesRef(context.Background(), bundle); err != nil {
+		t.Fatalf("resolveValuesRef() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"redis": map[string]interface{}{
+			"host": "10.0.0.1",
+			"auth": map[string]interface{}{"enabled": true},
+		},
+	}
+	if !reflect.DeepEqual(bundle.Spec.Values.Object, want) {
+		t.Errorf("resolveValuesRef() values = %#v, want %#v", bundle.Spec.Values.Object, want)
+	}
+}
+
+func TestResolveValuesRef_JSONPathKinds(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	service := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "redis"}}
+	r := &BundleReconciler{
+		Client:          fake.NewClientBuilder().WithScheme(scheme).WithObjects(service).Build(),
+		ValuesFromKinds: ParseGroupKinds([]string{"Deployment.apps"}),
+	}
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"},
+		Spec: bundlev1.BundleSpec{
+			ValuesFrom: []bundlev1.ValuesFrom{
+				{Kind: "Service", Name: "redis", JSONPath: "{.spec.clusterIP}", TargetPath: "redis.host", Optional: true},
+			},
+		},
+	}
+	if err := r.resolveValuesRef(context.Background(), bundle); err == nil {
+		t.Error("resolveValuesRef() of a kind not allowed = nil, want error")
+	}
+	r.ValuesFromKinds = ParseGroupKinds([]string{"Service", "Deployment.apps"})
+	if err := r.resolveValuesRef(context.Background(), bundle); err != nil {
+		t.Errorf("resolveValuesRef() of an allowed kind error = %v", err)
+	}
+	bundle.Spec.ValuesFrom[0].Optional = false
+	bundle.Spec.ValuesFrom[0].APIVersion, bundle.Spec.ValuesFrom[0].Kind = "example.com/v1", "Unknown"
+	r.ValuesFromKinds = nil
+	if err := r.resolveValuesRef(context.Background(), bundle); err == nil {
+		t.Error("resolveValuesRef() of a required unknown kind = nil, want error")
+	}
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reservedVariablePrefixes are prefixes of built-in variables, an undefined variable with them is an error.
+var reservedVariablePrefixes = []string{"bundle.", "cluster."}
+
+// variableRegexp matches "${name}" and the escaped "$${name}".
+var variableRegexp = regexp.MustCompile(`\$?\$\{([a-zA-Z_][a-zA-Z0-9_.\-]*)\}`)
+
+// substituteValues returns .spec.values of bundle with variables substituted, if substitution is enabled.
+func (r *BundleReconciler) substituteValues(ctx context.Context, bundle *bundlev1.Bundle) (map[string]interface{}, error) {
+	if !bundle.SubstitutionEnabled() {
+		return bundle.Spec.Values.Object, nil
+	}
+	variables, err := r.variablesOf(ctx, bundle)
+	if err != nil {
+		return nil, err
+	}
+	substituted, err := substitute(bundle.Spec.Values.Object, variables)
+	if err != nil {
+		return nil, fmt.Errorf("substitute values: %w", err)
+	}
+	values, _ := substituted.(map[string]interface{})
+	return values, nil
+}
+
+// variablesOf returns keys of .spec.variablesFrom and built-in variables of bundle, built-in ones take precedence.
+func (r *BundleReconciler) variablesOf(ctx context.Context, bundle *bundlev1.Bundle) (map[string]string, error) {
+	variables := map[string]string{}
+	for _, ref := range bundle.Spec.VariablesFrom {
+		key := client.ObjectKey{Namespace: bundle.Namespace, Name: ref.Name}
+		var err error
+		switch strings.ToLower(ref.Kind) {
+		case "secret", "secrets":
+			secret := &corev1.Secret{}
+			if err = r.Client.Get(ctx, key, secret); err == nil {
+				for k, v := range secret.Data {
+					variables[k] = string(v)
+				}
+			}
+		case "configmap", "configmaps":
+			configmap := &corev1.ConfigMap{}
+			if err = r.Client.Get(ctx, key, configmap); err == nil {
+				for k, v := range configmap.Data {
+					variables[k] = v
+				}
+			}
+		default:
+			return nil, fmt.Errorf("variablesFrom kind [%s] is not supported", ref.Kind)
+		}
+		if err != nil {
+			if ref.Optional && apierrors.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+	}
+	// cluster variables describe the cluster of the controller, even if the bundle is installed into a remote cluster
+	for k, v := range r.ClusterVariables {
+		variables["cluster."+k] = v
+	}
+	installNamespace := bundle.Spec.InstallNamespace
+	if installNamespace == "" {
+		installNamespace = bundle.Namespace
+	}
+	variables["bundle.name"] = bundle.Name
+	variables["bundle.namespace"] = bundle.Namespace
+	variables["bundle.installNamespace"] = installNamespace
+	return variables, nil
+}
+
+// substitute replaces "${name}" in string values of in with variables, "$${name}" is kept as "${name}".
+// Undefined variables are kept as is, except those with reserved prefixes.
+func substitute(in interface{}, variables map[string]string) (interface{}, error) {
+	switch val := in.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		var errs []error
+		for k, v := range val {
+			substituted, err := substitute(v, variables)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			out[k] = substituted
+		}
+		return out, utilerrors.NewAggregate(errs)
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		var errs []error
+		for i, v := range val {
+			substituted, err := substitute(v, variables)
+			if err != nil {
+				errs = append(errs, err)
+			}
+			out[i] = substituted
+		}
+		return out, utilerrors.NewAggregate(errs)
+	case string:
+		return substituteString(val, variables)
+	default:
+		return in, nil
+	}
+}
+
+func substituteString(in string, variables map[string]string) (string, error) {
+	var errs []error
+	out := variableRegexp.ReplaceAllStringFunc(in, func(match string) string {
+		if strings.HasPrefix(match, "$$") {
+			return match[1:]
+		}
+		name := match[2 : len(match)-1]
+		if value, ok := variables[name]; ok {
+			return value
+		}
+		for _, prefix := range reservedVariablePrefixes {
+			if strings.HasPrefix(name, prefix) {
+				errs = append(errs, fmt.Errorf("undefined variable %s", name))
+			}
+		}
+		return match
+	})
+	return out, utilerrors.NewAggregate(errs)
+}
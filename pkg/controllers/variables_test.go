@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	bundlecommon "kubegems.io/bundle-controller/pkg/apis/bundle"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestSubstituteString(t *testing.T) {
+	variables := map[string]string{"bundle.name": "foo", "cluster.domain": "example.com", "registry": "quay.io"}
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "${bundle.name}.${cluster.domain}", want: "foo.example.com"},
+		{in: "${registry}/nginx", want: "quay.io/nginx"},
+		{in: "$${bundle.name}", want: "${bundle.name}"},
+		{in: "echo ${HOME} ${1}", want: "echo ${HOME} ${1}"},
+		{in: "${cluster.name}", want: "${cluster.name}", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := substituteString(tt.in, variables)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("substituteString() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("substituteString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSubstituteValues(t *testing.T) {
+	configmap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "vars"},
+		Data:       map[string]string{"registry": "quay.io", "bundle.name": "ignored"},
+	}
+	r := &BundleReconciler{
+		Client:           fake.NewClientBuilder().WithScheme(clientgoscheme.Scheme).WithObjects(configmap).Build(),
+		ClusterVariables: map[string]string{"domain": "example.com"},
+	}
+	bundle := &bundlev1.Bundle{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+		Spec: bundlev1.BundleSpec{
+			InstallNamespace: "web",
+			VariablesFrom: []bundlev1.VariablesFrom{
+				{Kind: "ConfigMap", Name: "vars"},
+				{Kind: "Secret", Name: "missing", Optional: true},
+			},
+			Values: bundlev1.Values{Object: map[string]interface{}{
+				"image":    map[string]interface{}{"registry": "${registry}"},
+				"hosts":    []interface{}{"${bundle.name}.${bundle.installNamespace}.${cluster.domain}"},
+				"replicas": int64(2),
+			}},
+		},
+	}
+	got, err := r.substituteValues(context.Background(), bundle)
+	if err != nil {
+		t.Fatalf("substituteValues() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"image":    map[string]interface{}{"registry": "quay.io"},
+		"hosts":    []interface{}{"nginx.web.example.com"},
+		"replicas": int64(2),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("substituteValues() = %#v, want %#v", got, want)
+	}
+}
+
+func TestSubstituteValuesOptIn(t *testing.T) {
+	r := &BundleReconciler{ClusterVariables: map[string]string{"domain": "example.com"}}
+	values := map[string]interface{}{"host": "${bundle.name}.${cluster.domain}"}
+	tests := []struct {
+		name       string
+		annotation string
+		want       string
+	}{
+		{name: "default", want: "${bundle.name}.${cluster.domain}"},
+		{name: "enabled", annotation: bundlecommon.AnnotationSubstituteEnabled, want: "nginx.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle := &bundlev1.Bundle{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nginx"},
+				Spec:       bundlev1.BundleSpec{Values: bundlev1.Values{Object: values}},
+			}
+			if tt.annotation != "" {
+				bundle.Annotations = map[string]string{bundlecommon.AnnotationSubstitute: tt.annotation}
+			}
+			got, err := r.substituteValues(context.Background(), bundle)
+			if err != nil {
+				t.Fatalf("substituteValues() error = %v", err)
+			}
+			if got["host"] != tt.want {
+				t.Errorf("substituteValues() host = %v, want %s", got["host"], tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"context"
+	"reflect"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"kubegems.io/bundle-controller/pkg/bundle"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+//+kubebuilder:webhook:path=/validate-bundle-kubegems-io-v1beta1-bundle,mutating=false,failurePolicy=fail,sideEffects=None,groups=bundle.kubegems.io,resources=bundles,verbs=create;update,versions=v1beta1,name=vbundle.kubegems.io,admissionReviewVersions=v1
+
+// BundleValidator rejects invalid bundles on admission.
+type BundleValidator struct {
+	Validator *bundle.Validator
+}
+
+// SetupWebhook registers the validating webhook of bundles into the webhook server of mgr,
+// and the conversion webhook between v1 and the storage version v1beta1.
+func SetupWebhook(mgr ctrl.Manager, bundleoptions *bundle.Options) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(&bundlev1.Bundle{}).
+		WithValidator(&BundleValidator{Validator: &bundle.Validator{Options: bundleoptions}}).
+		Complete()
+}
+
+func (v *BundleValidator) ValidateCreate(ctx context.Context, obj runtime.Object) error {
+	bundle, ok := obj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	errs := v.Validator.Validate(bundle)
+	return toInvalidError(bundle, errs)
+}
+
+func (v *BundleValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) error {
+	old, ok := oldObj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	bundle, ok := newObj.(*bundlev1.Bundle)
+	if !ok {
+		return nil
+	}
+	// never block deleting or updates of metadata only, e.g. removing the finalizer of an existing invalid bundle
+	if bundle.DeletionTimestamp != nil || reflect.DeepEqual(old.Spec, bundle.Spec) {
+		return nil
+	}
+	errs := v.Validator.ValidateUpdate(old, bundle)
+	return toInvalidError(bundle, errs)
+}
+
+func (v *BundleValidator) ValidateDelete(ctx context.Context, obj runtime.Object) error {
+	return nil
+}
+
+func toInvalidError(bundle *bundlev1.Bundle, errs field.ErrorList) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(bundlev1.Kind("Bundle"), bundle.Name, errs)
+}
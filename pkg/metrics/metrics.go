@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+const namespace = "bundle"
+
+const (
+	OperationCreate = "create"
+	OperationUpdate = "update"
+	OperationDelete = "delete"
+
+	HelmOperationInstall   = "install"
+	HelmOperationUpgrade   = "upgrade"
+	HelmOperationUninstall = "uninstall"
+	HelmOperationRollback  = "rollback"
+	HelmOperationNoop      = "noop"
+
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+var (
+	DownloadDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "download_duration_seconds",
+		Help:      "Duration of bundle downloads by source type.",
+		Buckets:   []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 120, 300},
+	}, []string{"source", "kind"})
+
+	RenderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "render_duration_seconds",
+		Help:      "Duration of bundle manifests rendering.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"source", "kind"})
+
+	ApplyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "apply_duration_seconds",
+		Help:      "Duration of applying bundle manifests to cluster.",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"source", "kind"})
+
+	ResourceOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "resource_operations_total",
+		Help:      "Number of resources created, updated or deleted by bundle.",
+	}, []string{"namespace", "name", "operation"})
+
+	HelmOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "helm_operations_total",
+		Help:      "Number of helm operations by result.",
+	}, []string{"operation", "result"})
+)
+
+// nolint: gochecknoinits
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		DownloadDuration,
+		RenderDuration,
+		ApplyDuration,
+		ResourceOperations,
+		HelmOperations,
+	)
+}
+
+// ObserveSince observes seconds since start into histogram.
+func ObserveSince(observer prometheus.Observer, start time.Time) {
+	observer.Observe(time.Since(start).Seconds())
+}
+
+// DeleteBundle deletes series labeled by the bundle, once it is removed.
+func DeleteBundle(bundle *bundlev1.Bundle) {
+	for _, operation := range []string{OperationCreate, OperationUpdate, OperationDelete} {
+		ResourceOperations.DeleteLabelValues(bundle.Namespace, bundle.Name, operation)
+	}
+}
+
+// Result returns the result label value of err.
+func Result(err error) string {
+	if err != nil {
+		return ResultFailure
+	}
+	return ResultSuccess
+}
+
+// SourceType returns the source type of bundle used as "source" label.
+func SourceType(bundle *bundlev1.Bundle) string {
+	repo := bundle.Spec.URL
+	switch {
+	case len(bundle.Spec.ContentFrom) > 0:
+		return "contentFrom"
+	case repo == "":
+		return "local"
+	case strings.HasPrefix(repo, "file://"):
+		return "file"
+	case strings.HasSuffix(repo, ".git"):
+		return "git"
+	case strings.HasSuffix(repo, ".zip"):
+		return "zip"
+	case strings.HasSuffix(repo, ".tar.gz") || strings.HasSuffix(repo, ".tgz"):
+		return "tarball"
+	case bundle.Spec.Kind == bundlev1.BundleKindHelm:
+		return "helm"
+	default:
+		return "unknown"
+	}
+}
+
+// BundleLabels returns "source" and "kind" labels of bundle.
+func BundleLabels(bundle *bundlev1.Bundle) prometheus.Labels {
+	return prometheus.Labels{"source": SourceType(bundle), "kind": string(bundle.Spec.Kind)}
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"context"
+	"sync"
+)
+
+// running tracks functions of RunWithContext still running by key.
+var running = struct {
+	sync.Mutex
+	done map[string]chan struct{}
+}{done: map[string]chan struct{}{}}
+
+// RunWithContext runs fn and returns once fn returned or ctx is done, for functions can't be cancelled promptly.
+// fn should return soon after its ctx is done, if it can't, it keeps running in background and its result is dropped.
+// Calls with the same non-empty key are serialised, a call waits for the previous fn of the key even if abandoned,
+// so at most one fn of a key runs at a time.
+func RunWithContext[T any](ctx context.Context, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var zero T
+	release, err := acquire(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+	type result struct {
+		val T
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		defer release()
+		val, err := fn(ctx)
+		ch <- result{val: val, err: err}
+	}()
+	select {
+	case r := <-ch:
+		return r.val, r.err
+	case <-ctx.Done():
+		return zero, ctx.Err()
+	}
+}
+
+// acquire waits until no function of key is running, the returned release must be called once the function returned.
+func acquire(ctx context.Context, key string) (func(), error) {
+	if key == "" {
+		return func() {}, nil
+	}
+	for {
+		running.Lock()
+		prev, ok := running.done[key]
+		if !ok {
+			done := make(chan struct{})
+			running.done[key] = done
+			running.Unlock()
+			return func() {
+				running.Lock()
+				delete(running.done, key)
+				running.Unlock()
+				close(done)
+			}, nil
+		}
+		running.Unlock()
+		select {
+		case <-prev:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+type resyncContextKey struct{}
+
+// NewResyncContext returns a new context marks the sync as a periodic resync,
+// appliers apply resources of an up to date bundle again only on resync to correct drifts.
+func NewResyncContext(ctx context.Context) context.Context {
+	return context.WithValue(ctx, resyncContextKey{}, true)
+}
+
+// IsResync returns true if ctx is a periodic resync.
+func IsResync(ctx context.Context) bool {
+	resync, _ := ctx.Value(resyncContextKey{}).(bool)
+	return resync
+}
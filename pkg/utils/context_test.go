@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunWithContext(t *testing.T) {
+	val, err := RunWithContext(context.Background(), "", func(context.Context) (string, error) {
+		return "done", nil
+	})
+	if val != "done" || err != nil {
+		t.Errorf("RunWithContext() = %q, %v, want done", val, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cancelled := make(chan struct{})
+	if _, err := RunWithContext(ctx, "", func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return "", ctx.Err()
+	}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunWithContext() error = %v, want DeadlineExceeded", err)
+	}
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Error("fn is not cancelled with ctx")
+	}
+}
+
+func TestRunWithContextSerialised(t *testing.T) {
+	block := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	// an abandoned fn ignores ctx and keeps running
+	if _, err := RunWithContext(ctx, "key", func(context.Context) (int, error) {
+		<-block
+		return 1, nil
+	}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("RunWithContext() error = %v, want Canceled", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := RunWithContext(ctx, "key", func(context.Context) (int, error) {
+		t.Error("fn of the same key runs while the previous one is running")
+		return 2, nil
+	}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunWithContext() error = %v, want DeadlineExceeded", err)
+	}
+	if val, err := RunWithContext(context.Background(), "other", func(context.Context) (int, error) {
+		return 3, nil
+	}); val != 3 || err != nil {
+		t.Errorf("RunWithContext() of other key = %d, %v, want 3", val, err)
+	}
+
+	close(block)
+	if val, err := RunWithContext(context.Background(), "key", func(context.Context) (int, error) {
+		return 4, nil
+	}); val != 4 || err != nil {
+		t.Errorf("RunWithContext() after the previous returned = %d, %v, want 4", val, err)
+	}
+}
+
+func TestIsResync(t *testing.T) {
+	ctx := context.Background()
+	if IsResync(ctx) {
+		t.Error("IsResync() of background context = true, want false")
+	}
+	if !IsResync(NewResyncContext(ctx)) {
+		t.Error("IsResync() of resync context = false, want true")
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	EventReasonDownloaded        = "Downloaded"
+	EventReasonInstalled         = "Installed"
+	EventReasonUpgraded          = "Upgraded"
+	EventReasonUpToDate          = "UpToDate"
+	EventReasonPruned            = "Pruned"
+	EventReasonUninstalled       = "Uninstalled"
+	EventReasonOrphaned          = "Orphaned"
+	EventReasonWaitingDeps       = "WaitingForDependencies"
+	EventReasonSyncFailed        = "SyncFailed"
+	EventReasonRemoveFailed      = "RemoveFailed"
+	EventReasonRemoveBlocked     = "RemoveBlocked"
+	EventReasonTimeout           = "Timeout"
+	EventReasonRemediated        = "Remediated"
+	EventReasonRemediationFailed = "RemediationFailed"
+	EventReasonCleanupSkipped    = "CleanupSkipped"
+)
+
+// DefaultEventDedupTTL is the period an event is dropped if it is the same as the last event of the object.
+const DefaultEventDedupTTL = 10 * time.Minute
+
+// EventRecorder records events and drops an event if it equals the last event of the same object,
+// so repeated reconciles of an unchanged bundle do not flood the events.
+// A nil EventRecorder discards all events.
+type EventRecorder struct {
+	recorder record.EventRecorder
+	last     *cache.Expiring
+	ttl      time.Duration
+}
+
+func NewEventRecorder(recorder record.EventRecorder) *EventRecorder {
+	return &EventRecorder{recorder: recorder, last: cache.NewExpiring(), ttl: DefaultEventDedupTTL}
+}
+
+func (r *EventRecorder) Event(object runtime.Object, eventtype, reason, message string) {
+	if r == nil || r.recorder == nil {
+		return
+	}
+	if obj, ok := object.(client.Object); ok {
+		key := eventtype + "/" + reason + "/" + message
+		if last, ok := r.last.Get(obj.GetUID()); ok && last == key {
+			return
+		}
+		r.last.Set(obj.GetUID(), key, r.ttl)
+	}
+	r.recorder.Event(object, eventtype, reason, message)
+}
+
+func (r *EventRecorder) Eventf(object runtime.Object, eventtype, reason, messageFmt string, args ...interface{}) {
+	r.Event(object, eventtype, reason, fmt.Sprintf(messageFmt, args...))
+}
+
+type eventRecorderContextKey struct{}
+
+// NewEventRecorderContext returns a new context carries the recorder.
+func NewEventRecorderContext(ctx context.Context, recorder *EventRecorder) context.Context {
+	return context.WithValue(ctx, eventRecorderContextKey{}, recorder)
+}
+
+// EventRecorderFromContextOrDiscard returns the recorder in ctx, or a recorder discards all events.
+func EventRecorderFromContextOrDiscard(ctx context.Context) *EventRecorder {
+	if recorder, ok := ctx.Value(eventRecorderContextKey{}).(*EventRecorder); ok {
+		return recorder
+	}
+	return nil
+}
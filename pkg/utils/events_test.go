@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventRecorder_Dedup(t *testing.T) {
+	fake := record.NewFakeRecorder(10)
+	r := NewEventRecorder(fake)
+	foo := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "foo"}}
+	bar := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "bar", UID: "bar"}}
+
+	r.Event(foo, corev1.EventTypeNormal, EventReasonUpToDate, "up to date")
+	r.Event(foo, corev1.EventTypeNormal, EventReasonUpToDate, "up to date")
+	r.Event(bar, corev1.EventTypeNormal, EventReasonUpToDate, "up to date")
+	r.Eventf(foo, corev1.EventTypeWarning, EventReasonSyncFailed, "failed: %s", "timeout")
+	// the same as an earlier event but not the last one
+	r.Event(foo, corev1.EventTypeNormal, EventReasonUpToDate, "up to date")
+
+	want := []string{
+		"Normal UpToDate up to date",
+		"Normal UpToDate up to date",
+		"Warning SyncFailed failed: timeout",
+		"Normal UpToDate up to date",
+	}
+	if got := drainEvents(fake); !reflect.DeepEqual(got, want) {
+		t.Errorf("recorded events = %q, want %q", got, want)
+	}
+
+	// the last event expires after ttl
+	r.ttl = time.Millisecond
+	r.Event(foo, corev1.EventTypeNormal, EventReasonInstalled, "installed")
+	time.Sleep(10 * time.Millisecond)
+	r.Event(foo, corev1.EventTypeNormal, EventReasonInstalled, "installed")
+	if got := drainEvents(fake); len(got) != 2 {
+		t.Errorf("recorded events after ttl = %q, want 2 events", got)
+	}
+}
+
+func TestEventRecorder_Discard(t *testing.T) {
+	foo := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "foo", UID: "foo"}}
+	// must not panic
+	EventRecorderFromContextOrDiscard(context.Background()).Event(foo, corev1.EventTypeNormal, EventReasonInstalled, "installed")
+
+	r := NewEventRecorder(record.NewFakeRecorder(1))
+	if got := EventRecorderFromContextOrDiscard(NewEventRecorderContext(context.Background(), r)); got != r {
+		t.Errorf("EventRecorderFromContextOrDiscard() = %v, want %v", got, r)
+	}
+}
+
+func drainEvents(fake *record.FakeRecorder) []string {
+	var events []string
+	for {
+		select {
+		case event := <-fake.Events:
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// Health is the health of a resource.
+type Health struct {
+	Status  bundlev1.HealthStatus
+	Message string
+}
+
+func healthy() Health {
+	return Health{Status: bundlev1.HealthStatusHealthy}
+}
+
+func progressing(format string, args ...interface{}) Health {
+	return Health{Status: bundlev1.HealthStatusProgressing, Message: fmt.Sprintf(format, args...)}
+}
+
+func degraded(format string, args ...interface{}) Health {
+	return Health{Status: bundlev1.HealthStatusDegraded, Message: fmt.Sprintf(format, args...)}
+}
+
+// HealthChecker checks health of resources in cluster.
+type HealthChecker struct {
+	Client client.Client
+}
+
+// Check returns the aggregated health of resources and custom checks.
+// Degraded takes precedence over progressing, messages of unhealthy resources are joined.
+func (c *HealthChecker) Check(ctx context.Context, resources []corev1.ObjectReference, checks []bundlev1.HealthCheck) (Health, error) {
+	var degradeds, progressings []string
+	collect := func(ref corev1.ObjectReference, health Health) {
+		desc := ref.Kind + " " + ref.Name
+		if ref.Namespace != "" {
+			desc = ref.Kind + " " + ref.Namespace + "/" + ref.Name
+		}
+		switch health.Status {
+		case bundlev1.HealthStatusDegraded:
+			degradeds = append(degradeds, desc+": "+health.Message)
+		case bundlev1.HealthStatusProgressing:
+			progressings = append(progressings, desc+": "+health.Message)
+		}
+	}
+	for _, ref := range resources {
+		obj, err := c.get(ctx, ref)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				collect(ref, progressing("not found"))
+				continue
+			}
+			return Health{}, err
+		}
+		collect(ref, ResourceHealth(obj))
+	}
+	for _, check := range checks {
+		ref := corev1.ObjectReference{APIVersion: check.APIVersion, Kind: check.Kind, Namespace: check.Namespace, Name: check.Name}
+		obj, err := c.get(ctx, ref)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				collect(ref, progressing("not found"))
+				continue
+			}
+			return Health{}, err
+		}
+		health, err := CustomHealth(obj, check)
+		if err != nil {
+			return Health{}, err
+		}
+		collect(ref, health)
+	}
+	switch {
+	case len(degradeds) > 0:
+		return degraded("%s", strings.Join(degradeds, "; ")), nil
+	case len(progressings) > 0:
+		return progressing("%s", strings.Join(progressings, "; ")), nil
+	default:
+		return healthy(), nil
+	}
+}
+
+func (c *HealthChecker) get(ctx context.Context, ref corev1.ObjectReference) (*unstructured.Unstructured, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}, obj); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// CustomHealth evaluates the jsonpath of check on obj.
+func CustomHealth(obj *unstructured.Unstructured, check bundlev1.HealthCheck) (Health, error) {
+	value, found, err := FindJSONPath(obj.Object, check.JSONPath)
+	if err != nil {
+		return Health{}, fmt.Errorf("health check: %w", err)
+	}
+	result := ""
+	if found {
+		result = JSONPathString(value)
+	}
+	if check.Value != "" {
+		if result != check.Value {
+			return progressing("%s is %q, expected %q", check.JSONPath, result, check.Value), nil
+		}
+		return healthy(), nil
+	}
+	if result == "" || result == "false" {
+		return progressing("%s is %q", check.JSONPath, result), nil
+	}
+	return healthy(), nil
+}
+
+// ResourceHealth returns the health of obj from its status, the rules are similar to kstatus.
+// Resources without known status are healthy once exists.
+func ResourceHealth(obj *unstructured.Unstructured) Health {
+	if generation, observed, ok := observedGeneration(obj); ok && observed < generation {
+		return progressing("generation %d is not observed yet", generation)
+	}
+	gk := obj.GroupVersionKind().GroupKind()
+	switch gk.String() {
+	case "Deployment.apps":
+		return deploymentHealth(obj)
+	case "StatefulSet.apps":
+		return statefulSetHealth(obj)
+	case "DaemonSet.apps":
+		return daemonSetHealth(obj)
+	case "ReplicaSet.apps":
+		return replicasHealth(obj, "availableReplicas")
+	case "Job.batch":
+		return jobHealth(obj)
+	case "Pod":
+		return podHealth(obj)
+	case "PersistentVolumeClaim":
+		if phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase"); phase != string(corev1.ClaimBound) {
+			return progressing("phase is %q", phase)
+		}
+		return healthy()
+	case "Service":
+		return serviceHealth(obj)
+	case "CustomResourceDefinition.apiextensions.k8s.io":
+		return crdHealth(obj)
+	default:
+		return conditionsHealth(obj)
+	}
+}
+
+func observedGeneration(obj *unstructured.Unstructured) (int64, int64, bool) {
+	observed, ok, _ := unstructured.NestedInt64(obj.Object, "status", "observedGeneration")
+	if !ok {
+		return 0, 0, false
+	}
+	return obj.GetGeneration(), observed, true
+}
+
+func deploymentHealth(obj *unstructured.Unstructured) Health {
+	if cond := findCondition(obj, "Progressing"); cond != nil && cond.status == "False" && cond.reason == "ProgressDeadlineExceeded" {
+		return degraded("%s", cond.message)
+	}
+	replicas := specReplicas(obj)
+	updated := statusInt(obj, "updatedReplicas")
+	available := statusInt(obj, "availableReplicas")
+	total := statusInt(obj, "replicas")
+	switch {
+	case updated < replicas:
+		return progressing("%d of %d replicas updated", updated, replicas)
+	case total > updated:
+		return progressing("%d old replicas pending termination", total-updated)
+	case available < replicas:
+		return progressing("%d of %d replicas available", available, replicas)
+	}
+	return healthy()
+}
+
+func statefulSetHealth(obj *unstructured.Unstructured) Health {
+	replicas := specReplicas(obj)
+	if ready := statusInt(obj, "readyReplicas"); ready < replicas {
+		return progressing("%d of %d replicas ready", ready, replicas)
+	}
+	strategy, _, _ := unstructured.NestedString(obj.Object, "spec", "updateStrategy", "type")
+	if strategy == "OnDelete" {
+		return healthy()
+	}
+	if updated := statusInt(obj, "updatedReplicas"); updated < replicas {
+		return progressing("%d of %d replicas updated", updated, replicas)
+	}
+	current, _, _ := unstructured.NestedString(obj.Object, "status", "currentRevision")
+	update, _, _ := unstructured.NestedString(obj.Object, "status", "updateRevision")
+	if current != update {
+		return progressing("revision %s is rolling out", update)
+	}
+	return healthy()
+}
+
+func daemonSetHealth(obj *unstructured.Unstructured) Health {
+	desired := statusInt(obj, "desiredNumberScheduled")
+	if updated := statusInt(obj, "updatedNumberScheduled"); updated < desired {
+		return progressing("%d of %d pods updated", updated, desired)
+	}
+	if available := statusInt(obj, "numberAvailable"); available < desired {
+		return progressing("%d of %d pods available", available, desired)
+	}
+	return healthy()
+}
+
+func replicasHealth(obj *unstructured.Unstructured, field string) Health {
+	replicas := specReplicas(obj)
+	if current := statusInt(obj, field); current < replicas {
+		return progressing("%d of %d replicas available", current, replicas)
+	}
+	return healthy()
+}
+
+func jobHealth(obj *unstructured.Unstructured) Health {
+	if cond := findCondition(obj, "Failed"); cond != nil && cond.status == "True" {
+		return degraded("%s", cond.message)
+	}
+	if cond := findCondition(obj, "Complete"); cond != nil && cond.status == "True" {
+		return healthy()
+	}
+	return progressing("job is not completed")
+}
+
+func podHealth(obj *unstructured.Unstructured) Health {
+	phase, _, _ := unstructured.NestedString(obj.Object, "status", "phase")
+	switch corev1.PodPhase(phase) {
+	case corev1.PodSucceeded:
+		return healthy()
+	case corev1.PodFailed:
+		message, _, _ := unstructured.NestedString(obj.Object, "status", "message")
+		return degraded("pod failed: %s", message)
+	case corev1.PodRunning:
+		if cond := findCondition(obj, "Ready"); cond != nil && cond.status == "True" {
+			return healthy()
+		}
+		return progressing("pod is not ready")
+	}
+	return progressing("phase is %q", phase)
+}
+
+func serviceHealth(obj *unstructured.Unstructured) Health {
+	if t, _, _ := unstructured.NestedString(obj.Object, "spec", "type"); t != string(corev1.ServiceTypeLoadBalancer) {
+		return healthy()
+	}
+	if ingress, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress"); len(ingress) == 0 {
+		return progressing("load balancer is not assigned")
+	}
+	return healthy()
+}
+
+func crdHealth(obj *unstructured.Unstructured) Health {
+	if cond := findCondition(obj, "NamesAccepted"); cond != nil && cond.status == "False" {
+		return degraded("%s", cond.message)
+	}
+	if cond := findCondition(obj, "Established"); cond == nil || cond.status != "True" {
+		return progressing("not established")
+	}
+	return healthy()
+}
+
+// conditionsHealth checks the commonly used conditions of custom resources.
+func conditionsHealth(obj *unstructured.Unstructured) Health {
+	if cond := findCondition(obj, "Stalled"); cond != nil && cond.status == "True" {
+		return degraded("%s", cond.message)
+	}
+	if cond := findCondition(obj, "Reconciling"); cond != nil && cond.status == "True" {
+		return progressing("%s", cond.message)
+	}
+	if cond := findCondition(obj, "Ready"); cond != nil && cond.status == "False" {
+		return progressing("%s", cond.message)
+	}
+	return healthy()
+}
+
+type condition struct {
+	status, reason, message string
+}
+
+func findCondition(obj *unstructured.Unstructured, t string) *condition {
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, item := range conditions {
+		cond, ok := item.(map[string]interface{})
+		if !ok || cond["type"] != t {
+			continue
+		}
+		status, _ := cond["status"].(string)
+		reason, _ := cond["reason"].(string)
+		message, _ := cond["message"].(string)
+		return &condition{status: status, reason: reason, message: message}
+	}
+	return nil
+}
+
+func specReplicas(obj *unstructured.Unstructured) int64 {
+	replicas, ok, _ := unstructured.NestedInt64(obj.Object, "spec", "replicas")
+	if !ok {
+		return 1
+	}
+	return replicas
+}
+
+func statusInt(obj *unstructured.Unstructured, field string) int64 {
+	val, _, _ := unstructured.NestedInt64(obj.Object, "status", field)
+	return val
+}
@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	bundlev1 "kubegems.io/bundle-controller/pkg/apis/bundle/v1beta1"
+	"sigs.k8s.io/yaml"
+)
+
+func parseObject(t *testing.T, content string) *unstructured.Unstructured {
+	data, err := yaml.YAMLToJSON([]byte(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// decode numbers as int64 like objects from apiserver
+	obj := &unstructured.Unstructured{}
+	if err := obj.UnmarshalJSON(data); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestResourceHealth(t *testing.T) {
+	tests := []struct {
+		name   string
+		object string
+		want   bundlev1.HealthStatus
+	}{
+		{
+			name: "deployment rolling out",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 3, updatedReplicas: 2, availableReplicas: 2}
+`,
+			want: bundlev1.HealthStatusProgressing,
+		},
+		{
+			name: "deployment generation not observed",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 3}
+spec: {replicas: 1}
+status: {observedGeneration: 2, replicas: 1, updatedReplicas: 1, availableReplicas: 1}
+`,
+			want: bundlev1.HealthStatusProgressing,
+		},
+		{
+			name: "deployment available",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+metadata: {generation: 2}
+spec: {replicas: 2}
+status: {observedGeneration: 2, replicas: 2, updatedReplicas: 2, availableReplicas: 2}
+`,
+			want: bundlev1.HealthStatusHealthy,
+		},
+		{
+			name: "deployment deadline exceeded",
+			object: `
+apiVersion: apps/v1
+kind: Deployment
+spec: {replicas: 1}
+status:
+  conditions:
+  - {type: Progressing, status: "False", reason: ProgressDeadlineExceeded}
+`,
+			want: bundlev1.HealthStatusDegraded,
+		},
+		{
+			name: "job failed",
+			object: `
+apiVersion: batch/v1
+kind: Job
+status:
+  conditions:
+  - {type: Failed, status: "True", message: BackoffLimitExceeded}
+`,
+			want: bundlev1.HealthStatusDegraded,
+		},
+		{
+			name: "crd not established",
+			object: `
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+status:
+  conditions:
+  - {type: NamesAccepted, status: "True"}
+`,
+			want: bundlev1.HealthStatusProgressing,
+		},
+		{
+			name:   "configmap",
+			object: `{apiVersion: v1, kind: ConfigMap}`,
+			want:   bundlev1.HealthStatusHealthy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ResourceHealth(parseObject(t, tt.object)); got.Status != tt.want {
+				t.Errorf("ResourceHealth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCustomHealth(t *testing.T) {
+	obj := parseObject(t, `{apiVersion: example.com/v1, kind: Database, status: {phase: Running, ready: true}}`)
+	tests := []struct {
+		name  string
+		check bundlev1.HealthCheck
+		want  bundlev1.HealthStatus
+	}{
+		{name: "value matched", check: bundlev1.HealthCheck{JSONPath: "{.status.phase}", Value: "Running"}, want: bundlev1.HealthStatusHealthy},
+		{name: "value not matched", check: bundlev1.HealthCheck{JSONPath: "{.status.phase}", Value: "Ready"}, want: bundlev1.HealthStatusProgressing},
+		{name: "truthy", check: bundlev1.HealthCheck{JSONPath: "{.status.ready}"}, want: bundlev1.HealthStatusHealthy},
+		{name: "missing", check: bundlev1.HealthCheck{JSONPath: "{.status.endpoint}"}, want: bundlev1.HealthStatusProgressing},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := CustomHealth(obj, tt.check)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.want {
+				t.Errorf("CustomHealth() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// FindJSONPath evaluates the jsonpath expr on data, found is false if the result is empty.
+// A list of all matched values is returned if expr matches more than one.
+func FindJSONPath(data interface{}, expr string) (interface{}, bool, error) {
+	jp := jsonpath.New("").AllowMissingKeys(true)
+	if err := jp.Parse(expr); err != nil {
+		return nil, false, fmt.Errorf("invalid jsonpath %q: %w", expr, err)
+	}
+	results, err := jp.FindResults(data)
+	if err != nil {
+		return nil, false, fmt.Errorf("jsonpath %q: %w", expr, err)
+	}
+	values := []interface{}{}
+	for _, result := range results {
+		for _, value := range result {
+			values = append(values, value.Interface())
+		}
+	}
+	switch len(values) {
+	case 0:
+		return nil, false, nil
+	case 1:
+		return values[0], true, nil
+	default:
+		return values, true, nil
+	}
+}
+
+// JSONPathString formats a value of FindJSONPath as text, a string is kept as is, others are json encoded.
+func JSONPathString(value interface{}) string {
+	if str, ok := value.(string); ok {
+		return str
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(raw)
+}
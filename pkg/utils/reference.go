@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"strings"
+
 	corev1 "k8s.io/api/core/v1"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -13,3 +15,16 @@ func GetReference(obj client.Object) corev1.ObjectReference {
 		Name:       obj.GetName(),
 	}
 }
+
+// FormatObjects returns a short description of objects, like "ConfigMap default/foo, Namespace bar".
+func FormatObjects[T client.Object](objs []T) string {
+	descs := make([]string, 0, len(objs))
+	for _, obj := range objs {
+		name := obj.GetName()
+		if ns := obj.GetNamespace(); ns != "" {
+			name = ns + "/" + name
+		}
+		descs = append(descs, obj.GetObjectKind().GroupVersionKind().Kind+" "+name)
+	}
+	return strings.Join(descs, ", ")
+}